@@ -0,0 +1,87 @@
+// Package analyzer reports functions that are not instrumented, with suggested fixes that instrument them.
+package analyzer
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+	"github.com/nikolaydubina/go-instrument/processor"
+	"golang.org/x/tools/go/analysis"
+)
+
+var (
+	config = processor.DefaultTraceConfig
+
+	redactNames, redactTypes string
+)
+
+// Analyzer reports functions that go-instrument would instrument.
+// Context is matched by type. Generated files are not checked.
+var Analyzer = &analysis.Analyzer{
+	Name: "instrument",
+	Doc:  "report functions with context.Context that do not start span",
+	URL:  "https://github.com/nikolaydubina/go-instrument",
+	Run:  run,
+}
+
+func init() {
+	Analyzer.Flags.StringVar(&config.App, "app", config.App, "Application name")
+	Analyzer.Flags.StringVar(&config.Instrumenter, "instrumenter", config.Instrumenter, "Instrumenter to use (opentelemetry, datadog)")
+	Analyzer.Flags.BoolVar(&config.DefaultSelect, "default-select", config.DefaultSelect, "Check all by default")
+	Analyzer.Flags.StringVar(&redactNames, "redact-names", "", "Regular expression of names of sensitive parameters, which are reported")
+	Analyzer.Flags.StringVar(&redactTypes, "redact-types", "", "Comma separated types of sensitive parameters, which are reported")
+	Analyzer.Flags.BoolVar(&config.Redact.Hash, "redact-hash", false, "Hash values of sensitive parameters, instead of leaving them out")
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	if _, err := instrument.New(config.Instrumenter, instrument.Config{App: config.App}); err != nil {
+		return nil, err
+	}
+
+	conf := config
+	if redactNames != "" {
+		q, err := regexp.Compile(redactNames)
+		if err != nil {
+			return nil, err
+		}
+		conf.Redact.Names = []*regexp.Regexp{q}
+	}
+	if redactTypes != "" {
+		conf.Redact.Types = strings.Split(redactTypes, ",")
+	}
+
+	for _, file := range pass.Files {
+		if ast.IsGenerated(file) {
+			continue
+		}
+
+		p := processor.NewTraceProcessor(processor.DefaultTracePattern)
+		findings, redactions, err := p.CheckFile(pass.Fset, file, pass.TypesInfo, conf)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, q := range findings {
+			edits := make([]analysis.TextEdit, 0, len(q.Edits))
+			for _, e := range q.Edits {
+				edits = append(edits, analysis.TextEdit{Pos: e.Pos, End: e.End, NewText: e.NewText})
+			}
+
+			pass.Report(analysis.Diagnostic{
+				Pos:     q.Pos,
+				Message: q.SpanName + " missing span",
+				SuggestedFixes: []analysis.SuggestedFix{
+					{Message: "Instrument " + q.SpanName, TextEdits: edits},
+				},
+			})
+		}
+
+		for _, q := range redactions {
+			pass.Report(analysis.Diagnostic{Pos: q.Pos, Category: "redaction", Message: q.Message()})
+		}
+	}
+
+	return nil, nil
+}
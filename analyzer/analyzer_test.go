@@ -0,0 +1,19 @@
+package analyzer_test
+
+import (
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/analyzer"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), analyzer.Analyzer, "a")
+}
+
+func TestAnalyzer_Redactions(t *testing.T) {
+	analyzer.Analyzer.Flags.Set("redact-names", "(?i)pass")
+	defer analyzer.Analyzer.Flags.Set("redact-names", "")
+
+	analysistest.Run(t, analysistest.TestData(), analyzer.Analyzer, "redacted")
+}
@@ -0,0 +1,25 @@
+package a
+
+import (
+	"context"
+	stdctx "context"
+)
+
+type Cat struct{}
+
+func (s Cat) Name(ctx context.Context) (name string, err error) /* want `Cat.Name missing span` */ {
+	return "fluffer", nil
+}
+
+func Basic(ctx context.Context) /* want `Basic missing span` */ {
+	_ = ctx
+}
+
+func Aliased(ctx stdctx.Context) /* want `Aliased missing span` */ {
+	_ = ctx
+}
+
+func NoContext() {}
+
+//instrument:exclude Excluded
+func Excluded(ctx context.Context) {}
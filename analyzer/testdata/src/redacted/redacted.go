@@ -0,0 +1,8 @@
+package redacted
+
+import "context"
+
+//instrument:attrs
+func Login(ctx context.Context, user string, password string) /* want `Login missing span` `Login password is skipped` */ {
+	_ = ctx
+}
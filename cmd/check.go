@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+	"github.com/spf13/cobra"
+)
+
+// checkCmd reports functions that are not instrumented
+var checkCmd = &cobra.Command{
+	Use:          "check <path>...",
+	Short:        "Report functions that are not instrumented and exit with error if there are any. Redacted attributes are listed too.",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filenames, err := listFileNames(args)
+		if err != nil {
+			return err
+		}
+
+		config, err := traceConfig()
+		if err != nil {
+			return err
+		}
+
+		var count int
+		p := processor.NewTraceProcessor(processor.DefaultTracePattern)
+		for _, fileName := range filenames {
+			findings, redactions, err := p.Check(fileName, config)
+			if err != nil {
+				return err
+			}
+			for _, q := range findings {
+				fmt.Fprintln(cmd.OutOrStdout(), q)
+			}
+			count += len(findings)
+
+			// redacted attributes are listed for audit, and they are not errors
+			for _, q := range redactions {
+				fmt.Fprintln(cmd.OutOrStdout(), q)
+			}
+		}
+
+		if count > 0 {
+			return fmt.Errorf("%d functions missing span", count)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,9 @@
+// Command instrumentlint reports functions that are not instrumented, and instruments them with -fix.
+package main
+
+import (
+	"github.com/nikolaydubina/go-instrument/analyzer"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(analyzer.Analyzer) }
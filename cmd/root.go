@@ -22,39 +22,53 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
+	"github.com/nikolaydubina/go-instrument/instrument"
 	"github.com/nikolaydubina/go-instrument/processor"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile        string
+	configFileUsed string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "go-instrument <path>...",
 	Short: "A simple instrumentation tool for tracing application data.",
 	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if configFileUsed != "" {
+			fmt.Fprintln(os.Stderr, "Using config file:", configFileUsed)
+		}
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filenames, err := listFileNames(args)
 		if err != nil {
 			return err
 		}
 
-		tracePattern := processor.DefaultTracePattern
-		config := processor.TraceConfig{
-			App:           viper.GetString("app"),
-			Overwrite:     viper.GetBool("overwrite"),
-			DefaultSelect: viper.GetBool("default-select"),
-			SkipGenerated: viper.GetBool("skip-generated"),
+		config, err := traceConfig()
+		if err != nil {
+			return err
 		}
 
-		fmt.Println(config)
+		if config.Overlay, config.OverlayDir, err = overlayConfig(config); err != nil {
+			return err
+		}
+
+		tracePattern := processor.DefaultTracePattern
 
 		p := processor.NewParallelTraceProcessor(viper.GetInt("parallel"), tracePattern)
 		if err := p.Process(filenames, config); err != nil {
@@ -79,19 +93,43 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.go-instrument.yaml)")
 	rootCmd.Flags().IntP("parallel", "j", 1, "The number of parallel worker")
-	rootCmd.Flags().StringP("app", "n", "app", "Application name")
-	rootCmd.Flags().BoolP("overwrite", "w", false, "Overwrite original files")
-	rootCmd.Flags().BoolP("default-select", "s", true, "Instrument all by default")
-	rootCmd.Flags().BoolP("skip-generated", "k", false, "Skip generated files")
+	rootCmd.PersistentFlags().StringP("app", "n", "app", "Application name")
+	rootCmd.PersistentFlags().StringP("instrumenter", "i", instrument.NameOpenTelemetry, "Instrumenter to use ("+strings.Join(append(instrument.Names(), instrument.NameTemplate), ", ")+")")
+	rootCmd.PersistentFlags().BoolP("overwrite", "w", false, "Overwrite original files")
+	rootCmd.PersistentFlags().BoolP("default-select", "s", true, "Instrument all by default")
+	rootCmd.PersistentFlags().String("visibility", string(processor.VisibilityAll), "Instrument only functions with visibility (all, exported, unexported)")
+	rootCmd.PersistentFlags().BoolP("skip-generated", "k", false, "Skip generated files")
+	rootCmd.PersistentFlags().BoolP("skip-manual", "m", false, "Skip functions that already have spans made by hand")
+	rootCmd.PersistentFlags().Bool("update-spans", false, "Update spans inserted before that differ by name, eg after function is renamed")
+	rootCmd.PersistentFlags().BoolP("types", "t", false, "Match context by type, loading packages of files")
+	rootCmd.PersistentFlags().Bool("record-panic", false, "Record panics in spans of all functions and panic again")
+	rootCmd.PersistentFlags().Bool("return-attrs", false, "Record named results of basic types in span attributes")
+	rootCmd.PersistentFlags().Bool("name-results", false, "Name results of functions with unnamed error results, so that errors are recorded")
+	rootCmd.PersistentFlags().BoolP("list", "l", false, "List files whose instrumentation would change, instead of printing files")
+	rootCmd.PersistentFlags().BoolP("diff", "d", false, "Print diffs of instrumentation, instead of printing files")
+	rootCmd.Flags().String("overlay", "", "Write instrumented copies of files and overlay file for go build -overlay, instead of writing files")
+	rootCmd.Flags().String("overlay-dir", "", "Directory of instrumented copies of files (default is go-instrument in user cache directory)")
 
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
 	viper.SetEnvPrefix("INSTRA")
 	viper.BindPFlag("parallel", rootCmd.Flags().Lookup("parallel"))
-	viper.BindPFlag("app", rootCmd.Flags().Lookup("app"))
-	viper.BindPFlag("overwrite", rootCmd.Flags().Lookup("overwrite"))
-	viper.BindPFlag("default-select", rootCmd.Flags().Lookup("default-select"))
-	viper.BindPFlag("skip-generated", rootCmd.Flags().Lookup("skip-generated"))
+	viper.BindPFlag("app", rootCmd.PersistentFlags().Lookup("app"))
+	viper.BindPFlag("instrumenter", rootCmd.PersistentFlags().Lookup("instrumenter"))
+	viper.BindPFlag("overwrite", rootCmd.PersistentFlags().Lookup("overwrite"))
+	viper.BindPFlag("default-select", rootCmd.PersistentFlags().Lookup("default-select"))
+	viper.BindPFlag("visibility", rootCmd.PersistentFlags().Lookup("visibility"))
+	viper.BindPFlag("skip-generated", rootCmd.PersistentFlags().Lookup("skip-generated"))
+	viper.BindPFlag("skip-manual", rootCmd.PersistentFlags().Lookup("skip-manual"))
+	viper.BindPFlag("update-spans", rootCmd.PersistentFlags().Lookup("update-spans"))
+	viper.BindPFlag("types", rootCmd.PersistentFlags().Lookup("types"))
+	viper.BindPFlag("record-panic", rootCmd.PersistentFlags().Lookup("record-panic"))
+	viper.BindPFlag("return-attrs", rootCmd.PersistentFlags().Lookup("return-attrs"))
+	viper.BindPFlag("name-results", rootCmd.PersistentFlags().Lookup("name-results"))
+	viper.BindPFlag("list", rootCmd.PersistentFlags().Lookup("list"))
+	viper.BindPFlag("diff", rootCmd.PersistentFlags().Lookup("diff"))
+	viper.BindPFlag("overlay", rootCmd.Flags().Lookup("overlay"))
+	viper.BindPFlag("overlay-dir", rootCmd.Flags().Lookup("overlay-dir"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -114,14 +152,242 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		configFileUsed = viper.ConfigFileUsed()
 	}
 }
 
+// traceConfig from flags, ENV variables and config file.
+// Rules are from config file set by flag, or else from config file of project of each file.
+func traceConfig() (processor.TraceConfig, error) {
+	if err := registerTemplate(); err != nil {
+		return processor.TraceConfig{}, err
+	}
+	if name := viper.GetString("instrumenter"); !slices.Contains(instrument.Names(), name) {
+		return processor.TraceConfig{}, fmt.Errorf("%w: %s", instrument.ErrUnknownInstrumenter, name)
+	}
+
+	redact, err := redactPolicy()
+	if err != nil {
+		return processor.TraceConfig{}, err
+	}
+	ignoreErrors, err := ignoreErrors()
+	if err != nil {
+		return processor.TraceConfig{}, err
+	}
+	rules, err := ruleSet()
+	if err != nil {
+		return processor.TraceConfig{}, err
+	}
+	visibility := processor.Visibility(viper.GetString("visibility"))
+	switch visibility {
+	case processor.VisibilityAll, processor.VisibilityExported, processor.VisibilityUnexported:
+	default:
+		return processor.TraceConfig{}, fmt.Errorf("unknown visibility: %s", visibility)
+	}
+
+	return processor.TraceConfig{
+		App:              viper.GetString("app"),
+		Instrumenter:     viper.GetString("instrumenter"),
+		Overwrite:        viper.GetBool("overwrite"),
+		DefaultSelect:    viper.GetBool("default-select"),
+		Visibility:       visibility,
+		SkipGenerated:    viper.GetBool("skip-generated"),
+		SkipManual:       viper.GetBool("skip-manual"),
+		UpdateSpans:      viper.GetBool("update-spans"),
+		Types:            viper.GetBool("types"),
+		NameResults:      viper.GetBool("name-results"),
+		RecordPanic:      viper.GetBool("record-panic"),
+		ReturnAttributes: viper.GetBool("return-attrs"),
+		Redact:           redact,
+		IgnoreErrors:     ignoreErrors,
+		Rules:            rules,
+		List:             viper.GetBool("list"),
+		Diff:             viper.GetBool("diff"),
+	}, nil
+}
+
+// overlayConfig is overlay file and directory of instrumented copies, which is in user cache directory by default.
+func overlayConfig(config processor.TraceConfig) (overlay, dir string, err error) {
+	overlay, dir = viper.GetString("overlay"), viper.GetString("overlay-dir")
+	if overlay == "" {
+		return "", "", nil
+	}
+	if config.Overwrite {
+		return "", "", errors.New("overlay can not be used with overwrite")
+	}
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", "", err
+		}
+		dir = filepath.Join(cacheDir, "go-instrument")
+	}
+	return overlay, dir, nil
+}
+
+// redactPolicy from config file, where names are regular expressions and action is skip (default) or hash.
+func redactPolicy() (processor.RedactPolicy, error) {
+	var conf struct {
+		Names  []string `mapstructure:"names"`
+		Types  []string `mapstructure:"types"`
+		Action string   `mapstructure:"action"`
+	}
+	if err := viper.UnmarshalKey("redact", &conf); err != nil {
+		return processor.RedactPolicy{}, err
+	}
+
+	policy := processor.RedactPolicy{Types: conf.Types}
+	for _, q := range conf.Names {
+		re, err := regexp.Compile(q)
+		if err != nil {
+			return processor.RedactPolicy{}, err
+		}
+		policy.Names = append(policy.Names, re)
+	}
+
+	switch conf.Action {
+	case "", "skip":
+	case "hash":
+		policy.Hash = true
+	default:
+		return processor.RedactPolicy{}, fmt.Errorf("unknown redact action: %s", conf.Action)
+	}
+	return policy, nil
+}
+
+// ignoreErrors from config file, which are sentinel errors matched by errors.Is and types matched by errors.As.
+func ignoreErrors() ([]instrument.ErrorMatcher, error) {
+	var conf struct {
+		Is []string `mapstructure:"is"`
+		As []string `mapstructure:"as"`
+	}
+	if err := viper.UnmarshalKey("ignore_errors", &conf); err != nil {
+		return nil, err
+	}
+
+	var matchers []instrument.ErrorMatcher
+	for _, q := range conf.Is {
+		m, err := instrument.ParseErrorMatcher(q, false)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	for _, q := range conf.As {
+		m, err := instrument.ParseErrorMatcher(q, true)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// ruleSet from config file set by flag, or else from nearest config file in directories up from each file.
+func ruleSet() (processor.RuleSet, error) {
+	if cfgFile != "" {
+		return rulesOfConfigFile(viper.GetViper(), cfgFile)
+	}
+	return processor.NewProjectRuleSet(func(fileName string) (processor.RuleSet, error) {
+		v := viper.GetViper()
+		if fileName != configFileUsed {
+			v = viper.New()
+			v.SetConfigFile(fileName)
+			if err := v.ReadInConfig(); err != nil {
+				return processor.RuleSet{}, err
+			}
+			fmt.Fprintln(os.Stderr, "Using rules of config file:", fileName)
+		}
+		return rulesOfConfigFile(v, fileName)
+	}), nil
+}
+
+// rulesOfConfigFile read by viper, which file globs are relative to it.
+func rulesOfConfigFile(v *viper.Viper, fileName string) (processor.RuleSet, error) {
+	var conf []struct {
+		Action     string `mapstructure:"action"`
+		Package    string `mapstructure:"package"`
+		File       string `mapstructure:"file"`
+		Receiver   string `mapstructure:"receiver"`
+		Function   string `mapstructure:"function"`
+		Visibility string `mapstructure:"visibility"`
+	}
+	if err := v.UnmarshalKey("rules", &conf); err != nil {
+		return processor.RuleSet{}, err
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return processor.RuleSet{}, err
+	}
+
+	rules := processor.RuleSet{Dir: dir}
+	for _, q := range conf {
+		rule := processor.Rule{Package: q.Package, File: q.File, Receiver: q.Receiver, Visibility: processor.Visibility(q.Visibility)}
+
+		switch q.Action {
+		case "include":
+			rule.Include = true
+		case "exclude":
+		default:
+			return processor.RuleSet{}, fmt.Errorf("unknown rule action: %s", q.Action)
+		}
+
+		switch rule.Visibility {
+		case "", processor.VisibilityExported, processor.VisibilityUnexported:
+		default:
+			return processor.RuleSet{}, fmt.Errorf("unknown rule visibility: %s", q.Visibility)
+		}
+
+		if q.Function != "" {
+			if rule.Function, err = regexp.Compile(q.Function); err != nil {
+				return processor.RuleSet{}, err
+			}
+		}
+
+		for _, glob := range []string{q.Package, q.File} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return processor.RuleSet{}, fmt.Errorf("%w: %s", err, glob)
+			}
+		}
+
+		rules.Rules = append(rules.Rules, rule)
+	}
+	return rules, nil
+}
+
+// registerTemplate instrumenter when it is defined in config file.
+func registerTemplate() error {
+	if !viper.IsSet("template") {
+		if viper.GetString("instrumenter") == instrument.NameTemplate {
+			return errors.New("missing template in config file")
+		}
+		return nil
+	}
+
+	var conf instrument.TemplateConfig
+	if err := viper.UnmarshalKey("template", &conf); err != nil {
+		return err
+	}
+
+	factory, err := instrument.NewTemplateFactory(conf)
+	if err != nil {
+		return err
+	}
+	instrument.Register(instrument.NameTemplate, factory)
+	return nil
+}
+
+// listFileNames of files and of directories with their subdirectories.
+// Package pattern with /... suffix, eg ./..., is directory too, since directories are walked anyway.
 func listFileNames(args []string) ([]string, error) {
 	var filenames []string
 
 	for _, f := range args {
+		if dir, ok := strings.CutSuffix(filepath.ToSlash(f), "/..."); ok {
+			f = filepath.FromSlash(dir)
+		}
+
 		fileInfo, err := os.Stat(f)
 		if err != nil {
 			return []string{}, err
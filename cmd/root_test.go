@@ -68,6 +68,16 @@ func TestListFileName(t *testing.T) {
 				"../internal/testdata/walk/suv.go",
 			},
 		},
+		{
+			name: "PackagePattern",
+			args: []string{
+				"../internal/testdata/walk/dir1/dir4/...",
+			},
+			expected: []string{
+				"../internal/testdata/walk/dir1/dir4/abcdir4.go",
+				"../internal/testdata/walk/dir1/dir4/dir5/abcdir5.go",
+			},
+		},
 		{
 			name: "AllFilesInDirectory",
 			args: []string{
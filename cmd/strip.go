@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/nikolaydubina/go-instrument/processor"
+	"github.com/spf13/cobra"
+)
+
+// stripCmd removes instrumentation made by go-instrument
+var stripCmd = &cobra.Command{
+	Use:   "strip <path>...",
+	Short: "Remove instrumentation added by go-instrument.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filenames, err := listFileNames(args)
+		if err != nil {
+			return err
+		}
+
+		config, err := traceConfig()
+		if err != nil {
+			return err
+		}
+
+		p := processor.NewTraceProcessor(processor.DefaultTracePattern)
+		for _, fileName := range filenames {
+			if err := p.Strip(fileName, config); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stripCmd)
+}
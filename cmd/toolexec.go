@@ -0,0 +1,491 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// toolexecCmd instruments packages while they are compiled, without changing source files.
+var toolexecCmd = &cobra.Command{
+	Use:   "toolexec [flags] <tool> [args]...",
+	Short: `Instrument while compiling, use as: go build -toolexec="go-instrument toolexec"`,
+	Long: `Instrument while compiling, use as: go build -toolexec="go-instrument toolexec"
+
+Go source files of compiled packages are instrumented into temporary directory and passed to compiler instead of original files.
+Packages of standard library and module cache are not instrumented.
+Imported tracing library has to be in module dependencies.`,
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	// output of tools is shown by go build, so config file is not reported
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flagSet := cmd.InheritedFlags()
+		flags, tool := splitToolexecArgs(flagSet, args)
+		if len(tool) == 0 {
+			return errors.New("missing tool")
+		}
+		// flags are not parsed by cobra, since arguments of tool are not own flags
+		if err := flagSet.Parse(flags); err != nil {
+			return err
+		}
+		if cfgFile != "" {
+			initConfig()
+		}
+
+		config, err := traceConfig()
+		if err != nil {
+			return err
+		}
+
+		if len(tool) == 2 && tool[1] == "-V=full" {
+			return runToolVersion(tool)
+		}
+
+		switch toolName(tool[0]) {
+		case "compile":
+			tool, err = instrumentCompile(tool, config)
+		case "link":
+			tool, err = linkInstrumented(tool)
+		}
+		if err != nil {
+			return err
+		}
+
+		return runTool(tool)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(toolexecCmd)
+}
+
+// splitToolexecArgs into own flags and tool command, which starts with absolute path of tool.
+// Absolute path that follows own flag without value is value of that flag, eg --config /path.
+func splitToolexecArgs(flagSet *pflag.FlagSet, args []string) (flags, tool []string) {
+	for i, arg := range args {
+		if filepath.IsAbs(arg) && (i == 0 || !needsValue(flagSet, args[i-1])) {
+			return args[:i], args[i:]
+		}
+	}
+	return args, nil
+}
+
+// needsValue when arg is flag that is followed by its value.
+func needsValue(flagSet *pflag.FlagSet, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+
+	var flag *pflag.Flag
+	if name, ok := strings.CutPrefix(arg, "--"); ok {
+		flag = flagSet.Lookup(name)
+	} else if len(arg) == 2 {
+		flag = flagSet.ShorthandLookup(arg[1:])
+	}
+	return flag != nil && flag.NoOptDefVal == ""
+}
+
+func toolName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".exe")
+}
+
+func runTool(tool []string) error {
+	cmd := exec.Command(tool[0], tool[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
+
+// runToolVersion adds hash of go-instrument and its config to tool version,
+// so that go build cache does not mix packages compiled with and without instrumentation.
+func runToolVersion(tool []string) error {
+	out, err := exec.Command(tool[0], tool[1:]...).Output()
+	if err != nil {
+		return err
+	}
+
+	id, err := toolexecID()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(toolVersion(string(out), id))
+	return nil
+}
+
+// toolVersion keeps `buildID=` as last field, as it is expected by go build for development versions.
+func toolVersion(version, id string) string {
+	fs := strings.Fields(version)
+	mark := "go-instrument=" + id
+	if n := len(fs); n > 0 && strings.HasPrefix(fs[n-1], "buildID=") {
+		return strings.Join(slices.Insert(fs, n-1, mark), " ")
+	}
+	return strings.Join(append(fs, mark), " ")
+}
+
+func toolexecID() (string, error) {
+	h := sha256.New()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(exe)
+	if err != nil {
+		return "", err
+	}
+	h.Write(b)
+
+	// maps are printed in sorted order of keys
+	fmt.Fprint(h, viper.AllSettings())
+
+	return fmt.Sprintf("%x", h.Sum(nil))[:16], nil
+}
+
+// instrumentCompile writes instrumented Go files next to compiled archive and substitutes them in arguments of compiler.
+// Imports that are added by instrumentation are added to import config, and they are recorded for linker by build ID of archive.
+func instrumentCompile(tool []string, config processor.TraceConfig) ([]string, error) {
+	if slices.Contains(tool, "-std") {
+		return tool, nil
+	}
+
+	dir, err := toolexecDir(tool)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Overwrite = true
+	config.List, config.Diff = false, false
+	// files are copied out of their packages
+	config.Types = false
+	p := processor.NewTraceProcessor(processor.DefaultTracePattern)
+
+	// files generated by go build are in its work directory
+	workDir := filepath.Dir(filepath.Dir(dir))
+
+	args := slices.Clone(tool)
+	var instrumented []string
+
+	for i, arg := range args {
+		if filepath.Ext(arg) != ".go" || !isInstrumentable(arg, workDir) {
+			continue
+		}
+
+		src, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		fileName := filepath.Join(dir, filepath.Base(arg))
+		if err := os.WriteFile(fileName, src, 0644); err != nil {
+			return nil, err
+		}
+		// rules and package are of source file, rather than of its copy
+		config.SourceFile = arg
+		if err := p.Process(fileName, config); err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+
+		dst, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(src, dst) {
+			continue
+		}
+
+		args[i] = fileName
+		instrumented = append(instrumented, fileName)
+	}
+
+	if len(instrumented) == 0 {
+		return tool, nil
+	}
+
+	imports, err := importsFromFiles(instrumented)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeCompiledImports(tool, imports); err != nil {
+		return nil, err
+	}
+
+	return withImportConfig(args, dir, imports, false)
+}
+
+// linkInstrumented adds packages imported by instrumented files of linked archives to import config of linker.
+// Archives may be compiled by earlier builds, thus imports are found by build IDs of archives.
+func linkInstrumented(tool []string) ([]string, error) {
+	dir, err := toolexecDir(tool)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.Index(tool, "-importcfg")
+	if i < 0 || i+1 >= len(tool) {
+		return tool, nil
+	}
+	importcfg, err := os.ReadFile(tool[i+1])
+	if err != nil {
+		return nil, err
+	}
+
+	var imports []string
+	scanner := bufio.NewScanner(bytes.NewReader(importcfg))
+	for scanner.Scan() {
+		v, ok := strings.CutPrefix(scanner.Text(), "packagefile ")
+		if !ok {
+			continue
+		}
+		_, archive, _ := strings.Cut(v, "=")
+		q, err := readCompiledImports(archive)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range q {
+			if !slices.Contains(imports, path) {
+				imports = append(imports, path)
+			}
+		}
+	}
+
+	return withImportConfig(tool, dir, imports, true)
+}
+
+// compiledImportsDir is where imports of instrumented files are kept by action IDs of compiled archives.
+func compiledImportsDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "go-instrument", "toolexec"), nil
+}
+
+// writeCompiledImports by action ID, which is first part of build ID passed to compiler and written to archive.
+func writeCompiledImports(tool []string, imports []string) error {
+	i := slices.Index(tool, "-buildid")
+	if i < 0 || i+1 >= len(tool) {
+		return nil
+	}
+	actionID, _, _ := strings.Cut(tool[i+1], "/")
+
+	dir, err := compiledImportsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, actionID), []byte(strings.Join(imports, "\n")+"\n"), 0644)
+}
+
+// readCompiledImports of archive by action ID in its header, there are none when archive is not instrumented.
+func readCompiledImports(archive string) ([]string, error) {
+	actionID, err := archiveActionID(archive)
+	if err != nil || actionID == "" {
+		return nil, err
+	}
+
+	dir, err := compiledImportsDir()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, actionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// archiveActionID is read from line `build id "<action ID>/<content ID>"` in header of archive.
+func archiveActionID(archive string) (string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 1024)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	_, rest, ok := bytes.Cut(header[:n], []byte("\nbuild id \""))
+	if !ok {
+		return "", nil
+	}
+	actionID, _, ok := bytes.Cut(rest, []byte("/"))
+	if !ok {
+		return "", nil
+	}
+	return string(actionID), nil
+}
+
+// toolexecDir is directory next to output of tool, which is in go build work directory.
+func toolexecDir(tool []string) (string, error) {
+	i := slices.Index(tool, "-o")
+	if i < 0 || i+1 >= len(tool) {
+		return "", errors.New("missing output of tool")
+	}
+
+	dir := filepath.Join(filepath.Dir(tool[i+1]), "go-instrument")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// isInstrumentable when file is not from work directory, module cache or vendor directory.
+func isInstrumentable(fileName, workDir string) bool {
+	absName, err := filepath.Abs(fileName)
+	if err != nil {
+		return false
+	}
+
+	modCache := os.Getenv("GOMODCACHE")
+	if modCache == "" {
+		if gopath := filepath.SplitList(build.Default.GOPATH); len(gopath) > 0 {
+			modCache = filepath.Join(gopath[0], "pkg", "mod")
+		}
+	}
+
+	for _, q := range []string{workDir, modCache} {
+		if q != "" && strings.HasPrefix(absName, q+string(filepath.Separator)) {
+			return false
+		}
+	}
+	return !slices.Contains(strings.Split(filepath.ToSlash(absName), "/"), "vendor")
+}
+
+func importsFromFiles(fileNames []string) ([]string, error) {
+	var imports []string
+	fset := token.NewFileSet()
+	for _, fileName := range fileNames {
+		file, err := parser.ParseFile(fset, fileName, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range file.Imports {
+			path, err := strconv.Unquote(q.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(imports, path) {
+				imports = append(imports, path)
+			}
+		}
+	}
+	return imports, nil
+}
+
+// withImportConfig makes copy of import config passed to tool with packages that are missing in it.
+// Export data of packages is built by `go list`, with flags of build that are passed to tool, see buildFlags.
+func withImportConfig(tool []string, dir string, imports []string, deps bool) ([]string, error) {
+	i := slices.Index(tool, "-importcfg")
+	if i < 0 || i+1 >= len(tool) {
+		return tool, nil
+	}
+
+	importcfg, err := os.ReadFile(tool[i+1])
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{"unsafe": true, "C": true}
+	scanner := bufio.NewScanner(bytes.NewReader(importcfg))
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "packagefile "); ok {
+			path, _, _ := strings.Cut(v, "=")
+			known[path] = true
+		}
+	}
+
+	var missing []string
+	for _, q := range imports {
+		if !known[q] {
+			missing = append(missing, q)
+		}
+	}
+	if len(missing) == 0 {
+		return tool, nil
+	}
+
+	listArgs := []string{"list", "-export", "-f", "{{if .Export}}packagefile {{.ImportPath}}={{.Export}}{{end}}"}
+	if deps {
+		listArgs = append(listArgs, "-deps")
+	}
+	listArgs = append(listArgs, buildFlags(tool)...)
+	out, err := exec.Command("go", append(listArgs, missing...)...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("can not build imports of instrumentation %v: %s", missing, exitErr.Stderr)
+		}
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(importcfg)
+	if len(importcfg) > 0 && !bytes.HasSuffix(importcfg, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	scanner = bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		path, _, _ := strings.Cut(strings.TrimPrefix(line, "packagefile "), "=")
+		if line != "" && !known[path] {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	fileName := filepath.Join(dir, filepath.Base(tool[i+1]))
+	if err := os.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	args := slices.Clone(tool)
+	args[i+1] = fileName
+	return args, nil
+}
+
+// buildFlags of go build that change export data of all packages, which are passed to compiler and linker as well.
+// Other flags, eg -tags or -gcflags, are not passed to tools, thus they have to be set by GOFLAGS, which go list inherits.
+func buildFlags(tool []string) []string {
+	var flags []string
+	for _, q := range []string{"-race", "-msan", "-asan"} {
+		if slices.Contains(tool, q) {
+			flags = append(flags, q)
+		}
+	}
+	return flags
+}
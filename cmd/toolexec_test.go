@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitToolexecArgs(t *testing.T) {
+	flags, tool := splitToolexecArgs(toolexecCmd.InheritedFlags(), []string{"--app", "my-app", "/go/pkg/tool/compile", "-o", "/work/b001/_pkg_.a", "-p", "main"})
+	assert.Equal(t, []string{"--app", "my-app"}, flags)
+	assert.Equal(t, []string{"/go/pkg/tool/compile", "-o", "/work/b001/_pkg_.a", "-p", "main"}, tool)
+
+	flags, tool = splitToolexecArgs(toolexecCmd.InheritedFlags(), []string{"--config", "/app/config.yaml", "-w", "/go/pkg/tool/compile", "-p", "main"})
+	assert.Equal(t, []string{"--config", "/app/config.yaml", "-w"}, flags)
+	assert.Equal(t, []string{"/go/pkg/tool/compile", "-p", "main"}, tool)
+
+	flags, tool = splitToolexecArgs(toolexecCmd.InheritedFlags(), []string{"--app", "my-app"})
+	assert.Equal(t, []string{"--app", "my-app"}, flags)
+	assert.Empty(t, tool)
+}
+
+func TestToolVersion(t *testing.T) {
+	assert.Equal(t, "compile version go1.22.3 go-instrument=abc", toolVersion("compile version go1.22.3\n", "abc"))
+	assert.Equal(t, "compile version devel go1.23-123 go-instrument=abc buildID=xyz", toolVersion("compile version devel go1.23-123 buildID=xyz\n", "abc"))
+}
+
+func TestInstrumentCompile(t *testing.T) {
+	workDir := t.TempDir()
+	outDir := filepath.Join(workDir, "b001")
+	os.MkdirAll(outDir, 0755)
+
+	importcfg := filepath.Join(outDir, "importcfg")
+	os.WriteFile(importcfg, []byte("packagefile context=/a.a\npackagefile go.opentelemetry.io/otel=/b.a\npackagefile go.opentelemetry.io/otel/codes=/c.a\n"), 0644)
+
+	fileName := filepath.Join(t.TempDir(), "basic.go")
+	src, _ := os.ReadFile("../internal/testdata/basic.go")
+	os.WriteFile(fileName, src, 0644)
+
+	generated := filepath.Join(workDir, "b001", "_cgo_gotypes.go")
+	os.WriteFile(generated, []byte("package example\n"), 0644)
+
+	tool := []string{"/go/pkg/tool/compile", "-o", filepath.Join(outDir, "_pkg_.a"), "-p", "example", "-importcfg", importcfg, fileName, generated}
+	args, err := instrumentCompile(tool, processor.DefaultTraceConfig)
+	assert.Nil(t, err)
+
+	instrumented := filepath.Join(outDir, "go-instrument", "basic.go")
+	assert.Equal(t, []string{"/go/pkg/tool/compile", "-o", filepath.Join(outDir, "_pkg_.a"), "-p", "example", "-importcfg", importcfg, instrumented, generated}, args)
+
+	exp, _ := os.ReadFile("../internal/testdata/instrumented/basic.go.exp")
+	got, _ := os.ReadFile(instrumented)
+	assert.Equal(t, string(exp), string(got))
+
+	orig, _ := os.ReadFile(fileName)
+	assert.Equal(t, string(src), string(orig))
+}
+
+func TestInstrumentCompile_Std(t *testing.T) {
+	tool := []string{"/go/pkg/tool/compile", "-o", "/work/b001/_pkg_.a", "-std", "-p", "context", "/go/src/context/context.go"}
+	args, err := instrumentCompile(tool, processor.DefaultTraceConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, tool, args)
+}
+
+func TestIsInstrumentable(t *testing.T) {
+	t.Setenv("GOMODCACHE", "/go/pkg/mod")
+
+	assert.True(t, isInstrumentable("/src/project/main.go", "/tmp/go-build123"))
+	assert.False(t, isInstrumentable("/tmp/go-build123/b001/_cgo_gotypes.go", "/tmp/go-build123"))
+	assert.False(t, isInstrumentable("/go/pkg/mod/github.com/a/b@v1.0.0/b.go", "/tmp/go-build123"))
+	assert.False(t, isInstrumentable("/src/project/vendor/github.com/a/b/b.go", "/tmp/go-build123"))
+}
+
+func TestWithImportConfig_Missing(t *testing.T) {
+	dir := t.TempDir()
+	importcfg := filepath.Join(dir, "importcfg")
+	os.WriteFile(importcfg, []byte("packagefile context=/a.a\n"), 0644)
+
+	tool := []string{"/go/pkg/tool/compile", "-importcfg", importcfg}
+	args, err := withImportConfig(tool, dir, []string{"context", "unsafe"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, tool, args)
+
+	_, err = withImportConfig(tool, dir, []string{"example.com/does/not/exist"}, false)
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "example.com/does/not/exist"))
+	}
+}
+
+func TestArchiveActionID(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "_pkg_.a")
+	os.WriteFile(archive, []byte("!<arch>\n__.PKGDEF       0           0     0     644     20343     `\ngo object linux amd64 go1.22.3\nbuild id \"abc/xyz\"\n"), 0644)
+
+	actionID, err := archiveActionID(archive)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", actionID)
+}
+
+func TestBuildFlags(t *testing.T) {
+	tool := []string{"/go/pkg/tool/link", "-o", "a.out", "-race", "-importcfg", "importcfg.link", "-buildmode=exe"}
+	assert.Equal(t, []string{"-race"}, buildFlags(tool))
+}
@@ -0,0 +1,135 @@
+package instrument
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+)
+
+// Datadog instruments functions with native Datadog tracer.
+type Datadog struct {
+	ServiceName string
+
+	hasInserts bool
+	hasJoin    bool
+	hasPanic   bool
+}
+
+func (s *Datadog) Imports() []*types.Package {
+	if !s.hasInserts {
+		return nil
+	}
+	pkgs := []*types.Package{
+		types.NewPackage("gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer", ""),
+	}
+	if s.hasJoin {
+		pkgs = append(pkgs, types.NewPackage("errors", ""))
+	}
+	if s.hasPanic {
+		pkgs = append(pkgs, types.NewPackage("fmt", ""))
+	}
+	return pkgs
+}
+
+func (s *Datadog) PrefixStatements(fn Function) ([]ast.Stmt, error) {
+	s.hasInserts = true
+
+	stmts := []ast.Stmt{
+		&ast.AssignStmt{
+			Tok: token.DEFINE,
+			Lhs: []ast.Expr{&ast.Ident{Name: "span"}, &ast.Ident{Name: contextVar(fn)}},
+			Rhs: []ast.Expr{s.expFuncStart(s.ServiceName, fn.Context, fn.SpanName)},
+		},
+		&ast.DeferStmt{Call: s.expFuncFinish(fn.Errors)},
+	}
+	if fn.RecordPanic {
+		s.hasPanic = true
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncRecordPanic()}})
+	}
+	return stmts, nil
+}
+
+// Instrumented when body starts span with `tracer.StartSpanFromContext(...)` or `tracer.StartSpan(...)`.
+func (s *Datadog) Instrumented(body *ast.BlockStmt) bool {
+	return hasCall(body, func(call *ast.CallExpr) bool {
+		return isSelector(call.Fun, "tracer", "StartSpanFromContext") || isSelector(call.Fun, "tracer", "StartSpan")
+	})
+}
+
+func (s *Datadog) expFuncStart(serviceName, contextName, spanName string) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "tracer"}, Sel: &ast.Ident{Name: "StartSpanFromContext"}},
+		Args: []ast.Expr{
+			&ast.Ident{Name: contextName},
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(spanName)},
+			&ast.CallExpr{
+				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "tracer"}, Sel: &ast.Ident{Name: "ServiceName"}},
+				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(serviceName)}},
+			},
+		},
+	}
+}
+
+// expFuncFinish wraps error into closure, since arguments of deferred call are evaluated
+// at the moment of defer and named error would always be nil.
+// Many errors are joined into one.
+func (s *Datadog) expFuncFinish(errorNames []string) *ast.CallExpr {
+	finish := &ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "Finish"}},
+	}
+	if len(errorNames) == 0 {
+		return finish
+	}
+
+	var err ast.Expr = &ast.Ident{Name: errorNames[0]}
+	if len(errorNames) > 1 {
+		s.hasJoin = true
+		join := &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "errors"}, Sel: &ast.Ident{Name: "Join"}}}
+		for _, q := range errorNames {
+			join.Args = append(join.Args, &ast.Ident{Name: q})
+		}
+		err = join
+	}
+
+	finish.Args = []ast.Expr{
+		&ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "tracer"}, Sel: &ast.Ident{Name: "WithError"}},
+			Args: []ast.Expr{err},
+		},
+	}
+	return &ast.CallExpr{
+		Fun: &ast.FuncLit{
+			Type: &ast.FuncType{},
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: finish}}},
+		},
+	}
+}
+
+// exprFuncRecordPanic finishes span with panic as error and panics again.
+// Span is finished before deferred finish, which does nothing then.
+func (s *Datadog) exprFuncRecordPanic() ast.Expr {
+	r := &ast.Ident{Name: "r"}
+	return &ast.FuncLit{
+		Type: &ast.FuncType{},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.IfStmt{
+				Init: &ast.AssignStmt{Tok: token.DEFINE, Lhs: []ast.Expr{r}, Rhs: []ast.Expr{&ast.CallExpr{Fun: &ast.Ident{Name: "recover"}}}},
+				Cond: &ast.BinaryExpr{X: r, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ExprStmt{X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "Finish"}},
+						Args: []ast.Expr{&ast.CallExpr{
+							Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "tracer"}, Sel: &ast.Ident{Name: "WithError"}},
+							Args: []ast.Expr{&ast.CallExpr{
+								Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "fmt"}, Sel: &ast.Ident{Name: "Errorf"}},
+								Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"%v"`}, r},
+							}},
+						}},
+					}},
+					&ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.Ident{Name: "panic"}, Args: []ast.Expr{r}}},
+				}},
+			},
+		}},
+	}
+}
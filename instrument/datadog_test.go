@@ -0,0 +1,135 @@
+package instrument_test
+
+import (
+	"bytes"
+	_ "embed"
+	"go/printer"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+//go:embed testdata/datadog_error.go
+var expDatadogError string
+
+//go:embed testdata/datadog.go
+var expDatadog string
+
+//go:embed testdata/datadog_errors.go
+var expDatadogErrors string
+
+//go:embed testdata/datadog_panic.go
+var expDatadogPanic string
+
+func TestDatadog_Error(t *testing.T) {
+	p := instrument.Datadog{
+		ServiceName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", Errors: []string{"err"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expDatadogError {
+		t.Errorf("%s", s)
+	}
+
+	imports := p.Imports()
+	if len(imports) != 1 || imports[0].Path() != "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer" {
+		t.Error("wrong imports")
+	}
+}
+
+func TestDatadog_Errors(t *testing.T) {
+	p := instrument.Datadog{
+		ServiceName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "specialCtx", Errors: []string{"erra", "errb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expDatadogErrors {
+		t.Errorf("%s", s)
+	}
+
+	imports := p.Imports()
+	if len(imports) != 2 || imports[0].Path() != "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer" || imports[1].Path() != "errors" {
+		t.Error("wrong imports")
+	}
+}
+
+func TestDatadog_Panic(t *testing.T) {
+	p := instrument.Datadog{
+		ServiceName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", RecordPanic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expDatadogPanic {
+		t.Errorf("%s", s)
+	}
+
+	imports := p.Imports()
+	if len(imports) != 2 || imports[0].Path() != "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer" || imports[1].Path() != "fmt" {
+		t.Error("wrong imports")
+	}
+}
+
+func TestDatadog(t *testing.T) {
+	p := instrument.Datadog{
+		ServiceName: "app",
+	}
+	if imports := p.Imports(); len(imports) != 0 {
+		t.Error("no imports expected before inserts")
+	}
+
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expDatadog {
+		t.Errorf("%s", s)
+	}
+
+	imports := p.Imports()
+	if len(imports) != 1 || imports[0].Path() != "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer" {
+		t.Error("wrong imports")
+	}
+}
+
+func TestDatadog_QuotedSpanName(t *testing.T) {
+	p := instrument.Datadog{
+		ServiceName: `my"app`,
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: `checkout"pay`, Context: "ctx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	for _, s := range []string{`StartSpanFromContext(ctx, "checkout\"pay"`, `tracer.ServiceName("my\"app")`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %s in %s", s, out.String())
+		}
+	}
+}
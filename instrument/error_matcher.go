@@ -0,0 +1,102 @@
+package instrument
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+)
+
+// ErrorMatcher matches expected errors, which are recorded without error status of span.
+// Sentinel errors are matched by errors.Is and error types by errors.As.
+// Package is imported with name by PackageName, so that it is same as in inserted statements.
+type ErrorMatcher struct {
+	Path string
+	Name string
+
+	// Type is matched instead of sentinel error, and Pointer is set for pointer types.
+	Type    bool
+	Pointer bool
+}
+
+// ParseErrorMatcher of package qualified name, eg io.EOF or *net/url.Error for pointer type.
+func ParseErrorMatcher(s string, isType bool) (ErrorMatcher, error) {
+	m := ErrorMatcher{Type: isType}
+	if isType {
+		s, m.Pointer = strings.CutPrefix(s, "*")
+	}
+
+	i := strings.LastIndex(s, ".")
+	if i <= 0 || i == len(s)-1 || strings.HasSuffix(s[:i], "/") {
+		return ErrorMatcher{}, fmt.Errorf("error matcher is not package qualified name: %s", s)
+	}
+	m.Path, m.Name = s[:i], s[i+1:]
+	if !token.IsIdentifier(PackageName(m.Path)) {
+		return ErrorMatcher{}, fmt.Errorf("error matcher package has no name: %s", s)
+	}
+
+	return m, nil
+}
+
+// PackageName is guessed by import path, eg pgx for github.com/jackc/pgx/v5 and yaml for gopkg.in/yaml.v3.
+// It is last element of path without major version, extension and go- prefix, with characters that are not valid in names left out.
+func PackageName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	name, _, _ = strings.Cut(name, ".")
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+func isMajorVersion(s string) bool {
+	v, ok := strings.CutPrefix(s, "v")
+	return ok && v != "" && strings.Trim(v, "0123456789") == ""
+}
+
+func (m ErrorMatcher) pkg(fn Function) *types.Package {
+	return types.NewPackage(m.Path, fn.packageName(m.Path))
+}
+
+// expr is call of errors.Is or errors.As for error with name.
+func (m ErrorMatcher) expr(fn Function, errorName string) ast.Expr {
+	var target ast.Expr = &ast.SelectorExpr{X: &ast.Ident{Name: fn.packageName(m.Path)}, Sel: &ast.Ident{Name: m.Name}}
+	call := "Is"
+	if m.Type {
+		call = "As"
+		if m.Pointer {
+			target = &ast.StarExpr{X: target}
+		}
+		target = &ast.CallExpr{Fun: &ast.Ident{Name: "new"}, Args: []ast.Expr{target}}
+	}
+
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: fn.packageName("errors")}, Sel: &ast.Ident{Name: call}},
+		Args: []ast.Expr{&ast.Ident{Name: errorName}, target},
+	}
+}
+
+// exprUnexpected is condition that error with name matches none of matchers.
+func exprUnexpected(matchers []ErrorMatcher, fn Function, errorName string) ast.Expr {
+	var cond ast.Expr
+	for _, q := range matchers {
+		not := &ast.UnaryExpr{Op: token.NOT, X: q.expr(fn, errorName)}
+		if cond == nil {
+			cond = not
+		} else {
+			cond = &ast.BinaryExpr{X: cond, Op: token.LAND, Y: not}
+		}
+	}
+	return cond
+}
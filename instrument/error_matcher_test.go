@@ -0,0 +1,59 @@
+package instrument_test
+
+import (
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+func TestParseErrorMatcher(t *testing.T) {
+	tests := []struct {
+		s      string
+		isType bool
+		exp    instrument.ErrorMatcher
+	}{
+		{s: "io.EOF", exp: instrument.ErrorMatcher{Path: "io", Name: "EOF"}},
+		{s: "example.com/a/b.ErrNotFound", exp: instrument.ErrorMatcher{Path: "example.com/a/b", Name: "ErrNotFound"}},
+		{s: "*net/url.Error", isType: true, exp: instrument.ErrorMatcher{Path: "net/url", Name: "Error", Type: true, Pointer: true}},
+		{s: "os.SyscallError", isType: true, exp: instrument.ErrorMatcher{Path: "os", Name: "SyscallError", Type: true}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.s, func(t *testing.T) {
+			m, err := instrument.ParseErrorMatcher(tc.s, tc.isType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m != tc.exp {
+				t.Errorf("exp(%v) != (%v)", tc.exp, m)
+			}
+		})
+	}
+}
+
+func TestParseErrorMatcher_Error(t *testing.T) {
+	for _, s := range []string{"EOF", "io.", ".EOF", "example.com/.EOF", "example.com/1x.Err"} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := instrument.ParseErrorMatcher(s, false); err == nil {
+				t.Error("error expected")
+			}
+		})
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	tests := map[string]string{
+		"io":                          "io",
+		"net/url":                     "url",
+		"github.com/jackc/pgx/v5":     "pgx",
+		"gopkg.in/yaml.v3":            "yaml",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+		"example.com/v2":              "example",
+	}
+	for importPath, exp := range tests {
+		t.Run(importPath, func(t *testing.T) {
+			if s := instrument.PackageName(importPath); s != exp {
+				t.Errorf("exp(%s) != (%s)", exp, s)
+			}
+		})
+	}
+}
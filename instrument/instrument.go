@@ -0,0 +1,109 @@
+package instrument
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// Instrumenter supplies ast of Go code that will be inserted and required dependencies.
+// Error is returned when statements can not be made for function, and then file is not instrumented.
+type Instrumenter interface {
+	Imports() []*types.Package
+	PrefixStatements(fn Function) ([]ast.Stmt, error)
+}
+
+// Function is details of instrumented function that are used in inserted statements.
+type Function struct {
+	SpanName string
+
+	// Context is name of context parameter.
+	Context string
+
+	// RecordPanic in span and panic again.
+	RecordPanic bool
+
+	// UnusedContext when context is not used after inserted statements, so that it is not assigned.
+	UnusedContext bool
+
+	// Errors are names of error results.
+	Errors []string
+
+	// Params are parameters that are recorded in span attributes.
+	Params []Param
+
+	// Results are named results that are recorded in span attributes on return.
+	Results []Param
+
+	// PackageNames are names of imports of errors and packages of IgnoreErrors by paths, when names by PackageName are used in function.
+	PackageNames map[string]string
+}
+
+// packageName that package with import path is referenced by in inserted statements.
+func (fn Function) packageName(importPath string) string {
+	if name, ok := fn.PackageNames[importPath]; ok {
+		return name
+	}
+	return PackageName(importPath)
+}
+
+// Param is parameter or result of function.
+type Param struct {
+	Name string
+
+	// Type is expression of type in source.
+	Type ast.Expr
+
+	// TypeInfo is type in type-checked mode, and is nil otherwise.
+	TypeInfo types.Type
+
+	// Hash of value is recorded instead of value, since value is sensitive.
+	Hash bool
+}
+
+// Detector tells if function already has spans, eg written by hand.
+type Detector interface {
+	Instrumented(body *ast.BlockStmt) bool
+}
+
+// Config is trace configuration passed to Factory for each processed file.
+type Config struct {
+	App string
+
+	// IgnoreErrors are expected errors, which do not set error status of span.
+	IgnoreErrors []ErrorMatcher
+}
+
+// contextVar is variable that context with span is assigned to, which is blank when context is not used.
+func contextVar(fn Function) string {
+	if fn.UnusedContext {
+		return "_"
+	}
+	return fn.Context
+}
+
+// hasCall in body excluding nested function literals, since they are instrumented on their own.
+func hasCall(body *ast.BlockStmt, match func(call *ast.CallExpr) bool) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if match(n) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// isSelector is `pkg.Name` expression.
+func isSelector(e ast.Expr, pkg, name string) bool {
+	s, ok := e.(*ast.SelectorExpr)
+	if !ok || s.Sel == nil || s.Sel.Name != name {
+		return false
+	}
+	x, ok := s.X.(*ast.Ident)
+	return ok && x.Name == pkg
+}
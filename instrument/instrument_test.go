@@ -0,0 +1,74 @@
+package instrument_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+func TestDetector(t *testing.T) {
+	tests := []struct {
+		name     string
+		detector instrument.Detector
+		body     string
+		exp      bool
+	}{
+		{
+			name:     "otel",
+			detector: &instrument.OpenTelemetry{},
+			body:     `ctx, span := otel.Tracer("app").Start(ctx, "name"); defer span.End()`,
+			exp:      true,
+		},
+		{
+			name:     "otel nested block",
+			detector: &instrument.OpenTelemetry{},
+			body:     `if true { _, span := otel.Tracer("app").Start(ctx, "name"); defer span.End() }`,
+			exp:      true,
+		},
+		{
+			name:     "otel in function literal",
+			detector: &instrument.OpenTelemetry{},
+			body:     `f := func() { _, span := otel.Tracer("app").Start(ctx, "name"); defer span.End() }; f()`,
+			exp:      false,
+		},
+		{
+			name:     "otel other start",
+			detector: &instrument.OpenTelemetry{},
+			body:     `server.Start(ctx)`,
+			exp:      false,
+		},
+		{
+			name:     "datadog",
+			detector: &instrument.Datadog{},
+			body:     `span, ctx := tracer.StartSpanFromContext(ctx, "name"); defer span.Finish()`,
+			exp:      true,
+		},
+		{
+			name:     "datadog start span",
+			detector: &instrument.Datadog{},
+			body:     `span := tracer.StartSpan("name"); defer span.Finish()`,
+			exp:      true,
+		},
+		{
+			name:     "datadog otel",
+			detector: &instrument.Datadog{},
+			body:     `ctx, span := otel.Tracer("app").Start(ctx, "name"); defer span.End()`,
+			exp:      false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "", "package p; func _() {"+tc.body+"}", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := f.Decls[0].(*ast.FuncDecl).Body
+			if v := tc.detector.Instrumented(body); v != tc.exp {
+				t.Errorf("exp(%v) != (%v)", tc.exp, v)
+			}
+		})
+	}
+}
@@ -4,15 +4,23 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"strconv"
 )
 
 type OpenTelemetry struct {
-	TracerName  string
-	ContextName string
-	ErrorName   string
+	TracerName string
 
-	hasInserts bool
-	hasError   bool
+	// IgnoreErrors are recorded without error status of span.
+	IgnoreErrors []ErrorMatcher
+
+	hasInserts    bool
+	hasError      bool
+	hasAttributes bool
+	hasHash       bool
+	hasPanic      bool
+
+	// matcherImports are errors and packages of IgnoreErrors by names in functions
+	matcherImports []*types.Package
 }
 
 func (s *OpenTelemetry) Imports() []*types.Package {
@@ -22,69 +30,273 @@ func (s *OpenTelemetry) Imports() []*types.Package {
 	pkgs := []*types.Package{
 		types.NewPackage("go.opentelemetry.io/otel", ""),
 	}
-	if s.hasError {
+	if s.hasError || s.hasPanic {
 		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel/codes", "otelCodes"))
 	}
-	return pkgs
+	if s.hasAttributes {
+		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel/attribute", ""))
+	}
+	if s.hasHash {
+		pkgs = append(pkgs, types.NewPackage("crypto/sha256", ""))
+	}
+	if s.hasHash || s.hasPanic {
+		pkgs = append(pkgs, types.NewPackage("fmt", ""))
+	}
+	return append(pkgs, s.matcherImports...)
 }
 
-func (s *OpenTelemetry) PrefixStatements(spanName string, hasError bool) []ast.Stmt {
+func (s *OpenTelemetry) PrefixStatements(fn Function) ([]ast.Stmt, error) {
 	s.hasInserts = true
-	if hasError {
-		s.hasError = hasError
+	if len(fn.Errors) > 0 {
+		s.hasError = true
 	}
 
 	stmts := []ast.Stmt{
 		&ast.AssignStmt{
 			Tok: token.DEFINE,
-			Lhs: []ast.Expr{&ast.Ident{Name: s.ContextName}, &ast.Ident{Name: "span"}},
-			Rhs: []ast.Expr{s.expFuncSet(s.TracerName, spanName)},
+			Lhs: []ast.Expr{&ast.Ident{Name: contextVar(fn)}, &ast.Ident{Name: "span"}},
+			Rhs: []ast.Expr{s.expFuncSet(s.TracerName, fn.Context, fn.SpanName)},
 		},
 		&ast.DeferStmt{Call: &ast.CallExpr{
 			Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "End"}},
 		}},
 	}
-	if hasError {
-		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncSetSpanError(s.ErrorName)}})
+	if attrs := s.exprAttributes(fn.Params, ""); len(attrs) > 0 {
+		s.hasAttributes = true
+		stmts = append(stmts, &ast.ExprStmt{X: s.exprSetAttributes(attrs)})
+	}
+	if attrs := s.exprAttributes(fn.Results, "return."); len(attrs) > 0 {
+		s.hasAttributes = true
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.FuncLit{
+			Type: &ast.FuncType{},
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: s.exprSetAttributes(attrs)}}},
+		}}})
+	}
+	if len(fn.Errors) > 0 {
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncSetSpanError(fn)}})
+	}
+	if fn.RecordPanic {
+		s.hasPanic = true
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncRecordPanic()}})
 	}
-	return stmts
+	return stmts, nil
 }
 
-func (s *OpenTelemetry) expFuncSet(tracerName, spanName string) ast.Expr {
+// Instrumented when body starts span with `otel.Tracer(...).Start(...)`.
+func (s *OpenTelemetry) Instrumented(body *ast.BlockStmt) bool {
+	return hasCall(body, func(call *ast.CallExpr) bool {
+		start, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || start.Sel == nil || start.Sel.Name != "Start" {
+			return false
+		}
+		tracer, ok := start.X.(*ast.CallExpr)
+		return ok && isSelector(tracer.Fun, "otel", "Tracer")
+	})
+}
+
+func (s *OpenTelemetry) expFuncSet(tracerName, contextName, spanName string) ast.Expr {
 	return &ast.CallExpr{
 		Fun: &ast.SelectorExpr{
 			X: &ast.CallExpr{
 				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otel"}, Sel: &ast.Ident{Name: "Tracer"}},
-				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"` + tracerName + `"`}},
+				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(tracerName)}},
 			},
 			Sel: &ast.Ident{Name: "Start"},
 		},
-		Args: []ast.Expr{&ast.Ident{Name: "ctx"}, &ast.BasicLit{Kind: token.STRING, Value: `"` + spanName + `"`}},
+		Args: []ast.Expr{&ast.Ident{Name: contextName}, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(spanName)}},
 	}
 }
 
-func (s *OpenTelemetry) exprFuncSetSpanError(errorName string) ast.Expr {
+// exprFuncSetSpanError records each error that is not nil.
+// Errors that match IgnoreErrors are recorded as events, without error status.
+func (s *OpenTelemetry) exprFuncSetSpanError(fn Function) ast.Expr {
+	if len(s.IgnoreErrors) > 0 {
+		s.matcherImports = append(s.matcherImports, types.NewPackage("errors", fn.packageName("errors")))
+		for _, q := range s.IgnoreErrors {
+			s.matcherImports = append(s.matcherImports, q.pkg(fn))
+		}
+	}
+
+	var stmts []ast.Stmt
+	for _, errorName := range fn.Errors {
+		var setStatus ast.Stmt = &ast.ExprStmt{X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "SetStatus"}},
+			Args: []ast.Expr{
+				&ast.SelectorExpr{X: &ast.Ident{Name: "otelCodes"}, Sel: &ast.Ident{Name: "Error"}},
+				&ast.BasicLit{Kind: token.STRING, Value: `"error"`},
+			},
+		}}
+		if len(s.IgnoreErrors) > 0 {
+			setStatus = &ast.IfStmt{
+				Cond: exprUnexpected(s.IgnoreErrors, fn, errorName),
+				Body: &ast.BlockStmt{List: []ast.Stmt{setStatus}},
+			}
+		}
+
+		stmts = append(stmts, &ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: &ast.Ident{Name: errorName}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				setStatus,
+				&ast.ExprStmt{X: &ast.CallExpr{
+					Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "RecordError"}},
+					Args: []ast.Expr{
+						&ast.Ident{Name: errorName},
+					},
+				}},
+			}},
+		})
+	}
+
+	return &ast.FuncLit{
+		Type: &ast.FuncType{},
+		Body: &ast.BlockStmt{List: stmts},
+	}
+}
+
+// exprFuncRecordPanic records panic and panics again, so that span has error status when it ends.
+func (s *OpenTelemetry) exprFuncRecordPanic() ast.Expr {
+	r := &ast.Ident{Name: "r"}
 	return &ast.FuncLit{
 		Type: &ast.FuncType{},
 		Body: &ast.BlockStmt{List: []ast.Stmt{
 			&ast.IfStmt{
-				Cond: &ast.BinaryExpr{X: &ast.Ident{Name: "err"}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+				Init: &ast.AssignStmt{Tok: token.DEFINE, Lhs: []ast.Expr{r}, Rhs: []ast.Expr{&ast.CallExpr{Fun: &ast.Ident{Name: "recover"}}}},
+				Cond: &ast.BinaryExpr{X: r, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
 				Body: &ast.BlockStmt{List: []ast.Stmt{
 					&ast.ExprStmt{X: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "SetStatus"}},
-						Args: []ast.Expr{
-							&ast.SelectorExpr{X: &ast.Ident{Name: "otelCodes"}, Sel: &ast.Ident{Name: "Error"}},
-							&ast.BasicLit{Kind: token.STRING, Value: `"error"`},
-						},
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "RecordError"}},
+						Args: []ast.Expr{&ast.CallExpr{
+							Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "fmt"}, Sel: &ast.Ident{Name: "Errorf"}},
+							Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"%v"`}, r},
+						}},
 					}},
 					&ast.ExprStmt{X: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "RecordError"}},
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "SetStatus"}},
 						Args: []ast.Expr{
-							&ast.Ident{Name: errorName},
+							&ast.SelectorExpr{X: &ast.Ident{Name: "otelCodes"}, Sel: &ast.Ident{Name: "Error"}},
+							&ast.BasicLit{Kind: token.STRING, Value: `"panic"`},
 						},
 					}},
+					&ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.Ident{Name: "panic"}, Args: []ast.Expr{r}}},
 				}},
 			},
 		}},
 	}
 }
+
+// otelAttributeFuncs are names of attribute constructors by types of their values.
+var otelAttributeFuncs = map[types.BasicKind]string{
+	types.Bool:    "Bool",
+	types.Int:     "Int",
+	types.Int64:   "Int64",
+	types.Float64: "Float64",
+	types.String:  "String",
+}
+
+// otelAttributeValues are types of values of attributes for basic types.
+var otelAttributeValues = map[types.BasicKind]types.BasicKind{
+	types.Bool:    types.Bool,
+	types.Int:     types.Int,
+	types.Int8:    types.Int,
+	types.Int16:   types.Int,
+	types.Int32:   types.Int,
+	types.Int64:   types.Int64,
+	types.Uint:    types.Int64,
+	types.Uint8:   types.Int64,
+	types.Uint16:  types.Int64,
+	types.Uint32:  types.Int64,
+	types.Uint64:  types.Int64,
+	types.Uintptr: types.Int64,
+	types.Float32: types.Float64,
+	types.Float64: types.Float64,
+	types.String:  types.String,
+}
+
+var stringerType = types.NewInterfaceType([]*types.Func{
+	types.NewFunc(token.NoPos, nil, "String", types.NewSignatureType(nil, nil, nil, nil, types.NewTuple(types.NewVar(token.NoPos, nil, "", types.Typ[types.String])), false)),
+}, nil).Complete()
+
+func (s *OpenTelemetry) exprSetAttributes(attrs []ast.Expr) ast.Expr {
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "SetAttributes"}},
+		Args: attrs,
+	}
+}
+
+// exprAttributes of parameters that have basic types, or implement fmt.Stringer in type-checked mode.
+// Parameters of other types are skipped. Keys are names of parameters with prefix.
+// Values of sensitive parameters are hashed.
+func (s *OpenTelemetry) exprAttributes(params []Param, prefix string) []ast.Expr {
+	var attrs []ast.Expr
+	for _, q := range params {
+		fn, value, ok := otelAttribute(q)
+		if !ok {
+			continue
+		}
+
+		var v ast.Expr = &ast.Ident{Name: q.Name}
+		if q.Hash {
+			s.hasHash = true
+			fn, v = "String", exprHash(v)
+		} else if value != "" {
+			v = &ast.CallExpr{Fun: &ast.Ident{Name: value}, Args: []ast.Expr{v}}
+		}
+
+		attrs = append(attrs, &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "attribute"}, Sel: &ast.Ident{Name: fn}},
+			Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(prefix + q.Name)}, v},
+		})
+	}
+	return attrs
+}
+
+// otelAttribute is constructor of attribute for parameter and type its value is converted to, which is empty when conversion is not needed.
+// Without types, parameters of basic types are recognized by names of types.
+func otelAttribute(param Param) (fn, value string, ok bool) {
+	t := param.TypeInfo
+	if t == nil {
+		ident, ok := param.Type.(*ast.Ident)
+		if !ok {
+			return "", "", false
+		}
+		obj, ok := types.Universe.Lookup(ident.Name).(*types.TypeName)
+		if !ok {
+			return "", "", false
+		}
+		t = obj.Type()
+	}
+
+	// types other than basic types are converted to basic types
+	basic, isBasic := types.Unalias(t).(*types.Basic)
+	if !isBasic {
+		if types.Implements(t, stringerType) {
+			return "Stringer", "", true
+		}
+		if basic, ok = t.Underlying().(*types.Basic); !ok {
+			return "", "", false
+		}
+	}
+
+	kind, ok := otelAttributeValues[basic.Kind()]
+	if !ok {
+		return "", "", false
+	}
+	if isBasic && kind == basic.Kind() {
+		return otelAttributeFuncs[kind], "", true
+	}
+	return otelAttributeFuncs[kind], types.Typ[kind].Name(), true
+}
+
+// exprHash is hex of SHA-256 of value formatted by fmt.Sprint.
+// It is not salted, thus values that can be guessed are found by hashing guesses.
+func exprHash(v ast.Expr) ast.Expr {
+	sprint := &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "fmt"}, Sel: &ast.Ident{Name: "Sprint"}}, Args: []ast.Expr{v}}
+	sum := &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "sha256"}, Sel: &ast.Ident{Name: "Sum256"}},
+		Args: []ast.Expr{&ast.CallExpr{Fun: &ast.ArrayType{Elt: &ast.Ident{Name: "byte"}}, Args: []ast.Expr{sprint}}},
+	}
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "fmt"}, Sel: &ast.Ident{Name: "Sprintf"}},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"%x"`}, sum},
+	}
+}
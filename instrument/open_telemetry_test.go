@@ -3,8 +3,10 @@ package instrument_test
 import (
 	"bytes"
 	_ "embed"
+	"go/ast"
 	"go/printer"
 	"go/token"
+	"strings"
 	"testing"
 
 	"github.com/nikolaydubina/go-instrument/instrument"
@@ -16,13 +18,23 @@ var expOpenTelemetryError string
 //go:embed testdata/open_telemetry.go
 var expOpenTelemetry string
 
+//go:embed testdata/open_telemetry_errors.go
+var expOpenTelemetryErrors string
+
+//go:embed testdata/open_telemetry_panic.go
+var expOpenTelemetryPanic string
+
+//go:embed testdata/open_telemetry_attributes.go
+var expOpenTelemetryAttributes string
+
 func TestOpenTelemetry_Error(t *testing.T) {
 	p := instrument.OpenTelemetry{
-		TracerName:  "app",
-		ContextName: "ctx",
-		ErrorName:   "err",
+		TracerName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", Errors: []string{"err"}})
+	if err != nil {
+		t.Fatal(err)
 	}
-	c := p.PrefixStatements("myClass.MyFunction", true)
 
 	var out bytes.Buffer
 	printer.Fprint(&out, token.NewFileSet(), c)
@@ -45,13 +57,101 @@ func TestOpenTelemetry_Error(t *testing.T) {
 		t.Error("wrong imports")
 	}
 }
+func TestOpenTelemetry_Errors(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "specialCtx", Errors: []string{"erra", "errb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryErrors {
+		t.Errorf("%s", s)
+	}
+}
+
+func TestOpenTelemetry_Panic(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", RecordPanic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryPanic {
+		t.Errorf("%s", s)
+	}
+
+	expImports := map[string]bool{
+		"go.opentelemetry.io/otel ":                true,
+		"go.opentelemetry.io/otel/codes otelCodes": true,
+		"fmt ": true,
+	}
+	imports := p.Imports()
+	for _, pkg := range imports {
+		if !expImports[pkg.Path()+" "+pkg.Name()] {
+			t.Errorf("wrong import")
+		}
+	}
+	if len(imports) != len(expImports) {
+		t.Error("wrong imports")
+	}
+}
+
+func TestOpenTelemetry_Attributes(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", Params: []instrument.Param{
+		{Name: "name", Type: &ast.Ident{Name: "string"}},
+		{Name: "count", Type: &ast.Ident{Name: "uint"}},
+		{Name: "point", Type: &ast.Ident{Name: "Point"}},
+	}, Results: []instrument.Param{
+		{Name: "size", Type: &ast.Ident{Name: "float32"}},
+		{Name: "err", Type: &ast.Ident{Name: "error"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryAttributes {
+		t.Errorf("%s", s)
+	}
+
+	expImports := map[string]bool{
+		"go.opentelemetry.io/otel":           true,
+		"go.opentelemetry.io/otel/attribute": true,
+	}
+	imports := p.Imports()
+	for _, pkg := range imports {
+		if !expImports[pkg.Path()+pkg.Name()] {
+			t.Errorf("wrong import")
+		}
+	}
+	if len(imports) != len(expImports) {
+		t.Error("wrong imports")
+	}
+}
+
 func TestOpenTelemetry(t *testing.T) {
 	p := instrument.OpenTelemetry{
-		TracerName:  "app",
-		ContextName: "ctx",
-		ErrorName:   "err",
+		TracerName: "app",
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx"})
+	if err != nil {
+		t.Fatal(err)
 	}
-	c := p.PrefixStatements("myClass.MyFunction", false)
 
 	var out bytes.Buffer
 	printer.Fprint(&out, token.NewFileSet(), c)
@@ -73,3 +173,22 @@ func TestOpenTelemetry(t *testing.T) {
 		t.Error("wrong imports")
 	}
 }
+
+func TestOpenTelemetry_QuotedSpanName(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName: `my"app`,
+	}
+	c, err := p.PrefixStatements(instrument.Function{SpanName: `checkout"pay`, Context: "ctx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	for _, s := range []string{`otel.Tracer("my\"app")`, `Start(ctx, "checkout\"pay")`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %s in %s", s, out.String())
+		}
+	}
+}
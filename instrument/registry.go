@@ -0,0 +1,75 @@
+package instrument
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	NameOpenTelemetry = "opentelemetry"
+	NameDatadog       = "datadog"
+)
+
+var (
+	ErrUnknownInstrumenter = errors.New("unknown instrumenter")
+)
+
+// Factory makes new Instrumenter. Instrumenters keep state of statements they made, thus new one is made for each function.
+type Factory func(conf Config) Instrumenter
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{
+	factories: map[string]Factory{
+		NameOpenTelemetry: func(conf Config) Instrumenter {
+			return &OpenTelemetry{TracerName: conf.App, IgnoreErrors: conf.IgnoreErrors}
+		},
+		NameDatadog: func(conf Config) Instrumenter {
+			return &Datadog{ServiceName: conf.App}
+		},
+	},
+}
+
+// Register makes Instrumenter available by name. Registering same name again replaces previous factory.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.factories[name] = factory
+}
+
+// New makes Instrumenter registered under name.
+func New(name string, conf Config) (Instrumenter, error) {
+	factory, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(conf), nil
+}
+
+// Lookup factory registered under name.
+func Lookup(name string) (Factory, error) {
+	registry.RLock()
+	factory, ok := registry.factories[name]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownInstrumenter, name)
+	}
+	return factory, nil
+}
+
+// Names of registered instrumenters in sorted order.
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
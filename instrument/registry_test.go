@@ -0,0 +1,53 @@
+package instrument_test
+
+import (
+	"errors"
+	"go/ast"
+	"go/types"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+type noopInstrumenter struct{ app string }
+
+func (s noopInstrumenter) Imports() []*types.Package { return nil }
+
+func (s noopInstrumenter) PrefixStatements(fn instrument.Function) ([]ast.Stmt, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	instrument.Register("noop", func(conf instrument.Config) instrument.Instrumenter {
+		return noopInstrumenter{app: conf.App}
+	})
+
+	for _, name := range []string{instrument.NameOpenTelemetry, instrument.NameDatadog, "noop"} {
+		if !slices.Contains(instrument.Names(), name) {
+			t.Errorf("%s is not registered", name)
+		}
+	}
+
+	p, err := instrument.New("noop", instrument.Config{App: "my-app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := p.(noopInstrumenter); !ok || v.app != "my-app" {
+		t.Errorf("wrong instrumenter %#v", p)
+	}
+
+	p, err = instrument.New(instrument.NameOpenTelemetry, instrument.Config{App: "my-app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := p.(*instrument.OpenTelemetry); !ok || v.TracerName != "my-app" {
+		t.Errorf("wrong instrumenter %#v", p)
+	}
+}
+
+func TestRegistry_Unknown(t *testing.T) {
+	if _, err := instrument.New("asdf", instrument.Config{}); !errors.Is(err, instrument.ErrUnknownInstrumenter) {
+		t.Errorf("expected unknown instrumenter error, got %v", err)
+	}
+}
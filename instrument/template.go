@@ -0,0 +1,227 @@
+package instrument
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"text/template"
+)
+
+const NameTemplate = "template"
+
+// TemplateConfig is Go code snippets with placeholders of TemplateData.
+// Panic is rendered for functions that record panics, and these can not be instrumented without it.
+type TemplateConfig struct {
+	Imports      []TemplateImport `mapstructure:"imports"`
+	ErrorImports []TemplateImport `mapstructure:"error_imports"`
+	PanicImports []TemplateImport `mapstructure:"panic_imports"`
+	Prefix       string           `mapstructure:"prefix"`
+	Error        string           `mapstructure:"error"`
+	Panic        string           `mapstructure:"panic"`
+}
+
+type TemplateImport struct {
+	Name string `mapstructure:"name"`
+	Path string `mapstructure:"path"`
+}
+
+// TemplateData is passed to templates, eg `{{.CtxVar}}, span := otel.Tracer("{{.App}}").Start({{.Ctx}}, "{{.SpanName}}")`
+// CtxVar is Ctx, or blank identifier when context is not used after inserted statements.
+// Error template is rendered for each error result with its name in Err.
+type TemplateData struct {
+	SpanName string
+	Ctx      string
+	CtxVar   string
+	Err      string
+	App      string
+}
+
+// Template instruments functions with statements rendered from Go code snippets.
+type Template struct {
+	App string
+
+	prefix       *template.Template
+	error        *template.Template
+	panic        *template.Template
+	imports      []*types.Package
+	errorImports []*types.Package
+	panicImports []*types.Package
+
+	hasInserts bool
+	hasError   bool
+	hasPanic   bool
+}
+
+// NewTemplateFactory parses templates and checks that they render to valid Go statements.
+func NewTemplateFactory(conf TemplateConfig) (Factory, error) {
+	if conf.Prefix == "" {
+		return nil, errors.New("template: missing prefix")
+	}
+
+	prefix, err := template.New("prefix").Option("missingkey=error").Parse(conf.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	tmplError, err := template.New("error").Option("missingkey=error").Parse(conf.Error)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	tmplPanic, err := template.New("panic").Option("missingkey=error").Parse(conf.Panic)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	imports, err := templateImports(conf.Imports)
+	if err != nil {
+		return nil, err
+	}
+	errorImports, err := templateImports(conf.ErrorImports)
+	if err != nil {
+		return nil, err
+	}
+	panicImports, err := templateImports(conf.PanicImports)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := TemplateData{SpanName: "Type.Function", Ctx: "ctx", CtxVar: "ctx", Err: "err", App: "app"}
+	for _, t := range []*template.Template{prefix, tmplError, tmplPanic} {
+		if _, err := renderStatements(t, sample); err != nil {
+			return nil, err
+		}
+	}
+
+	// functions that record panics are not instrumented without panic template
+	if conf.Panic == "" {
+		tmplPanic = nil
+	}
+
+	factory := func(c Config) Instrumenter {
+		return &Template{
+			App:          c.App,
+			prefix:       prefix,
+			error:        tmplError,
+			panic:        tmplPanic,
+			imports:      imports,
+			errorImports: errorImports,
+			panicImports: panicImports,
+		}
+	}
+	return factory, nil
+}
+
+func (s *Template) Imports() []*types.Package {
+	if !s.hasInserts {
+		return nil
+	}
+	pkgs := append([]*types.Package{}, s.imports...)
+	if s.hasError {
+		pkgs = append(pkgs, s.errorImports...)
+	}
+	if s.hasPanic {
+		pkgs = append(pkgs, s.panicImports...)
+	}
+	return pkgs
+}
+
+// PrefixStatements renders templates.
+// Templates are validated by NewTemplateFactory, yet they can render to invalid Go for some functions, eg by conditions on span name.
+func (s *Template) PrefixStatements(fn Function) ([]ast.Stmt, error) {
+	data := TemplateData{
+		SpanName: fn.SpanName,
+		Ctx:      fn.Context,
+		CtxVar:   contextVar(fn),
+		App:      s.App,
+	}
+
+	stmts, err := renderStatements(s.prefix, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.SpanName, err)
+	}
+	s.hasInserts = true
+
+	for _, errorName := range fn.Errors {
+		data.Err = errorName
+		errStmts, err := renderStatements(s.error, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.SpanName, err)
+		}
+		if len(errStmts) > 0 {
+			s.hasError = true
+		}
+		stmts = append(stmts, errStmts...)
+	}
+
+	if fn.RecordPanic {
+		if s.panic == nil {
+			return nil, fmt.Errorf("%s: template: missing panic, which is required to record panics", fn.SpanName)
+		}
+		panicStmts, err := renderStatements(s.panic, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.SpanName, err)
+		}
+		s.hasPanic = true
+		stmts = append(stmts, panicStmts...)
+	}
+
+	return stmts, nil
+}
+
+func templateImports(imports []TemplateImport) ([]*types.Package, error) {
+	pkgs := make([]*types.Package, 0, len(imports))
+	for _, q := range imports {
+		if q.Path == "" {
+			return nil, errors.New("template: missing import path")
+		}
+		pkgs = append(pkgs, types.NewPackage(q.Path, q.Name))
+	}
+	return pkgs, nil
+}
+
+func renderStatements(t *template.Template, data TemplateData) ([]ast.Stmt, error) {
+	var buf bytes.Buffer
+	// keep wrapper on first line, so that error positions match lines of template
+	buf.WriteString("package p; func _() {")
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	buf.WriteString("\n}\n")
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", t.Name(), err)
+	}
+
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	resetPositions(body)
+	return body.List, nil
+}
+
+// resetPositions so that statements are printed as if they were made by hand and not from other token.FileSet.
+func resetPositions(node ast.Node) {
+	posType := reflect.TypeOf(token.NoPos)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		v := reflect.ValueOf(n)
+		if v.Kind() != reflect.Pointer || v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+		if v.Kind() != reflect.Struct {
+			return true
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == posType && f.CanSet() {
+				f.SetInt(int64(token.NoPos))
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,145 @@
+package instrument_test
+
+import (
+	"bytes"
+	"go/printer"
+	"go/token"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+var templateOpenTelemetry = instrument.TemplateConfig{
+	Imports: []instrument.TemplateImport{
+		{Path: "go.opentelemetry.io/otel"},
+	},
+	ErrorImports: []instrument.TemplateImport{
+		{Path: "go.opentelemetry.io/otel/codes", Name: "otelCodes"},
+	},
+	Prefix: `
+{{.Ctx}}, span := otel.Tracer("{{.App}}").Start({{.Ctx}}, "{{.SpanName}}")
+defer span.End()`,
+	Error: `
+defer func() {
+	if {{.Err}} != nil {
+		span.SetStatus(otelCodes.Error, "error")
+		span.RecordError({{.Err}})
+	}
+}()`,
+	PanicImports: []instrument.TemplateImport{
+		{Path: "fmt"},
+		{Path: "go.opentelemetry.io/otel/codes", Name: "otelCodes"},
+	},
+	Panic: `
+defer func() {
+	if r := recover(); r != nil {
+		span.RecordError(fmt.Errorf("%v", r))
+		span.SetStatus(otelCodes.Error, "panic")
+		panic(r)
+	}
+}()`,
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		errors  []string
+		panic   bool
+		exp     string
+		imports []string
+	}{
+		{
+			name:    "error",
+			errors:  []string{"err"},
+			exp:     expOpenTelemetryError,
+			imports: []string{"go.opentelemetry.io/otel ", "go.opentelemetry.io/otel/codes otelCodes"},
+		},
+		{
+			name:    "no error",
+			exp:     expOpenTelemetry,
+			imports: []string{"go.opentelemetry.io/otel "},
+		},
+		{
+			name:    "panic",
+			panic:   true,
+			exp:     expOpenTelemetryPanic,
+			imports: []string{"go.opentelemetry.io/otel ", "fmt ", "go.opentelemetry.io/otel/codes otelCodes"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory, err := instrument.NewTemplateFactory(templateOpenTelemetry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := factory(instrument.Config{App: "app"})
+			c, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", Errors: tc.errors, RecordPanic: tc.panic})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			printer.Fprint(&out, token.NewFileSet(), c)
+
+			if s := out.String(); s != tc.exp {
+				t.Errorf("%s", s)
+			}
+
+			imports := p.Imports()
+			if len(imports) != len(tc.imports) {
+				t.Fatalf("wrong imports %v", imports)
+			}
+			for i, pkg := range imports {
+				if s := pkg.Path() + " " + pkg.Name(); s != tc.imports[i] {
+					t.Errorf("wrong import %s", s)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTemplateFactory_Error(t *testing.T) {
+	tests := map[string]instrument.TemplateConfig{
+		"missing prefix":      {},
+		"bad template":        {Prefix: "{{.Ctx"},
+		"unknown placeholder": {Prefix: "{{.Context}}, span := Start({{.Context}})"},
+		"bad go":              {Prefix: "{{.Ctx}}, span := Start({{.Ctx}}"},
+		"bad error go":        {Prefix: "defer Start()", Error: "if {{.Err}} {"},
+		"missing import path": {Prefix: "defer Start()", Imports: []instrument.TemplateImport{{Name: "otel"}}},
+		"bad panic go":        {Prefix: "defer Start()", Panic: "defer func() {"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := instrument.NewTemplateFactory(tc); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTemplate_RenderError(t *testing.T) {
+	factory, err := instrument.NewTemplateFactory(instrument.TemplateConfig{Prefix: `{{if eq .SpanName "bad"}}(({{end}}defer Start()`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := factory(instrument.Config{App: "app"})
+
+	if _, err := p.PrefixStatements(instrument.Function{SpanName: "bad", Context: "ctx"}); err == nil {
+		t.Error("expected error")
+	}
+	if imports := p.Imports(); len(imports) != 0 {
+		t.Errorf("unexpected imports %v", imports)
+	}
+}
+
+func TestTemplate_PanicMissing(t *testing.T) {
+	factory, err := instrument.NewTemplateFactory(instrument.TemplateConfig{Prefix: "defer Start()"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := factory(instrument.Config{App: "app"})
+
+	if _, err := p.PrefixStatements(instrument.Function{SpanName: "myClass.MyFunction", Context: "ctx", RecordPanic: true}); err == nil {
+		t.Error("expected error")
+	}
+}
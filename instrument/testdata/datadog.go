@@ -0,0 +1,2 @@
+span, ctx := tracer.StartSpanFromContext(ctx, "myClass.MyFunction", tracer.ServiceName("app"))
+defer span.Finish()
\ No newline at end of file
@@ -0,0 +1,4 @@
+span, ctx := tracer.StartSpanFromContext(ctx, "myClass.MyFunction", tracer.ServiceName("app"))
+defer func() {
+	span.Finish(tracer.WithError(err))
+}()
\ No newline at end of file
@@ -0,0 +1,4 @@
+span, specialCtx := tracer.StartSpanFromContext(specialCtx, "myClass.MyFunction", tracer.ServiceName("app"))
+defer func() {
+	span.Finish(tracer.WithError(errors.Join(erra, errb)))
+}()
\ No newline at end of file
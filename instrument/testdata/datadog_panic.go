@@ -0,0 +1,8 @@
+span, ctx := tracer.StartSpanFromContext(ctx, "myClass.MyFunction", tracer.ServiceName("app"))
+defer span.Finish()
+defer func() {
+	if r := recover(); r != nil {
+		span.Finish(tracer.WithError(fmt.Errorf("%v", r)))
+		panic(r)
+	}
+}()
\ No newline at end of file
@@ -0,0 +1,6 @@
+ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction")
+defer span.End()
+span.SetAttributes(attribute.String("name", name), attribute.Int64("count", int64(count)))
+defer func() {
+	span.SetAttributes(attribute.Float64("return.size", float64(size)))
+}()
\ No newline at end of file
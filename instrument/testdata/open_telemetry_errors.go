@@ -0,0 +1,12 @@
+specialCtx, span := otel.Tracer("app").Start(specialCtx, "myClass.MyFunction")
+defer span.End()
+defer func() {
+	if erra != nil {
+		span.SetStatus(otelCodes.Error, "error")
+		span.RecordError(erra)
+	}
+	if errb != nil {
+		span.SetStatus(otelCodes.Error, "error")
+		span.RecordError(errb)
+	}
+}()
\ No newline at end of file
@@ -0,0 +1,9 @@
+ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction")
+defer span.End()
+defer func() {
+	if r := recover(); r != nil {
+		span.RecordError(fmt.Errorf("%v", r))
+		span.SetStatus(otelCodes.Error, "panic")
+		panic(r)
+	}
+}()
\ No newline at end of file
@@ -0,0 +1,32 @@
+package example
+
+import (
+	"context"
+)
+
+//instrument:include re:^Handle.*|glob:*Repo.*
+//instrument:exclude glob:*Repo.Delete
+
+func HandleGet(ctx context.Context) error {
+	return nil
+}
+
+func Get(ctx context.Context) error {
+	return nil
+}
+
+type UserRepo struct{}
+
+func (s UserRepo) Find(ctx context.Context) error {
+	return nil
+}
+
+func (s UserRepo) Delete(ctx context.Context) error {
+	return nil
+}
+
+type Cache struct{}
+
+func (s Cache) Find(ctx context.Context) error {
+	return nil
+}
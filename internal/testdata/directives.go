@@ -0,0 +1,25 @@
+package example
+
+import (
+	"context"
+)
+
+type Checkout struct{}
+
+// Pay for order.
+//
+//instrument:span name=checkout.pay
+func (s Checkout) Pay(ctx context.Context) error {
+	return nil
+}
+
+//instrument:skip
+func (s Checkout) Health(ctx context.Context) error {
+	return nil
+}
+
+type Cart struct{}
+
+func (s Cart) Health(ctx context.Context) error {
+	return nil
+}
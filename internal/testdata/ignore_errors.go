@@ -0,0 +1,35 @@
+package example
+
+import (
+	"context"
+	"io"
+)
+
+type Cat struct{}
+
+func (s Cat) Fetch(ctx context.Context, url string) (body string, err error) {
+	return url, nil
+}
+
+func Fetch(ctx context.Context) (body string, err error) {
+	return "", io.EOF
+}
+
+func Join(ctx context.Context, errors []error) (err error) {
+	return errors[0]
+}
+
+func Read(ctx context.Context) (err error) {
+	io := func() error { return nil }
+	return io()
+}
+
+func Run(ctx context.Context, url string) (err error) {
+	return Exec(ctx, func(ctx context.Context) (err error) {
+		return nil
+	})
+}
+
+func Exec(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,29 @@
+package example
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+)
+
+func Manual(ctx context.Context) (err error) {
+	ctx, span := otel.Tracer("custom").Start(ctx, "custom-name")
+	defer span.End()
+
+	return nil
+}
+
+func ManualNested(ctx context.Context, a int) int {
+	if a > 0 {
+		ctx, span := otel.Tracer("custom").Start(ctx, "positive")
+		defer span.End()
+	}
+	return a
+}
+
+func NotManual(ctx context.Context) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ctx, span := otel.Tracer("custom").Start(ctx, "closure")
+		defer span.End()
+	}
+}
@@ -0,0 +1,21 @@
+package example
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func Handle(ctx context.Context, id string) {
+	ctx, span := otel.Tracer("app").Start(ctx, "custom.handle")
+	defer span.End()
+	span.SetAttributes(attribute.String("id", id))
+	if id == "" {
+		span.AddEvent("empty")
+	}
+
+	Save(ctx, id)
+}
+
+func Save(ctx context.Context, id string) {}
@@ -0,0 +1,11 @@
+package example
+
+import "context"
+
+//instrument:panic Risky
+
+func Risky(ctx context.Context) {
+	panic("risky")
+}
+
+func Safe(ctx context.Context) {}
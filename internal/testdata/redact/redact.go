@@ -0,0 +1,17 @@
+package redact
+
+import "context"
+
+type Token string
+
+type Credentials struct {
+	User     string
+	Password string `instrument:"redact"`
+}
+
+func (c Credentials) String() string { return c.User }
+
+//instrument:attrs
+func Login(ctx context.Context, user string, password string, token Token, creds Credentials) {}
+
+func Logout(ctx context.Context, user string, password string) {}
@@ -0,0 +1,23 @@
+package rules
+
+import (
+	"context"
+)
+
+//instrument:include refresh
+
+type Repo struct{}
+
+func (s Repo) Find(ctx context.Context) error {
+	return nil
+}
+
+func (s *Repo) MustFind(ctx context.Context) {}
+
+func (s *Repo) find(ctx context.Context) error {
+	return nil
+}
+
+func (s *Repo) refresh(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+package typed
+
+import (
+	"context"
+	. "context"
+	stdctx "context"
+)
+
+type Ctx = context.Context
+
+type Contexter interface {
+	context.Context
+}
+
+type LoggerContext interface {
+	context.Context
+	Log(msg string)
+}
+
+func Aliased(ctx stdctx.Context) {}
+
+func DotImported(ctx Context) {}
+
+func TypeAlias(ctx Ctx) {}
+
+func SameInterface(ctx Contexter) {}
+
+func OtherInterface(ctx LoggerContext) {}
+
+func UsedOtherInterface(ctx LoggerContext) { ctx.Log("message") }
+
+func NotContext(ctx string) {}
+
+func Generic[C context.Context](ctx C) {}
+
+type Level int
+
+func (l Level) String() string { return "level" }
+
+type Count uint
+
+type Point struct{ X, Y int }
+
+//instrument:attrs
+func Attributes(ctx context.Context, n int, l Level, c Count, f float32, p Point) {}
+
+//instrument:attrs name
+func SelectedAttributes(ctx context.Context, name string, n int) {}
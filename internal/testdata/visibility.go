@@ -0,0 +1,41 @@
+package example
+
+import (
+	"context"
+)
+
+var handler = func(ctx context.Context) {}
+
+type Client struct{}
+
+func (s Client) Get(ctx context.Context) error {
+	call := func(ctx context.Context) {}
+	call(ctx)
+	return nil
+}
+
+func (s Client) get(ctx context.Context) error {
+	return nil
+}
+
+type client struct{}
+
+func (s client) Get(ctx context.Context) error {
+	return nil
+}
+
+func Get(ctx context.Context) error {
+	return nil
+}
+
+type Cache[K comparable, V any] struct{}
+
+func (s *Cache[K, V]) Get(ctx context.Context) error {
+	return nil
+}
+
+type box[T any] struct{}
+
+func (s *box[T]) Get(ctx context.Context) error {
+	return nil
+}
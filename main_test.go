@@ -37,21 +37,565 @@ func TestApp(t *testing.T) {
 		cmd := exec.Command(testbin, "--app", "app", "-w", f)
 		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
 		if err := cmd.Run(); err != nil {
-			t.Errorf(err.Error())
+			t.Error(err)
 		}
 		assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", f)
 	})
 
+	t.Run("when datadog, then ok", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--instrumenter", "datadog", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic_datadog.go.exp", f)
+	})
+
+	t.Run("when template, then ok", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--config", "./internal/testdata/config/template.yaml", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic_template.go.exp", f)
+	})
+
+	t.Run("when ignore errors, then expected errors without error status", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--config", "./internal/testdata/config/ignore_errors.yaml", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic_ignore_errors.go.exp", f)
+	})
+
+	t.Run("when ignore errors and names are used in functions, then packages imported by other names", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/ignore_errors.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--config", "./internal/testdata/config/ignore_errors.yaml", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/ignore_errors.go.exp", f)
+
+		cmd = exec.Command(testbin, "strip", "--app", "app", "-w", "--config", "./internal/testdata/config/ignore_errors.yaml", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/ignore_errors.go", f)
+	})
+
+	t.Run("when bad template, then err", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--config", "./internal/testdata/config/template_bad.yaml", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err == nil {
+			t.Errorf("expected exit code 1")
+		}
+	})
+
+	t.Run("when unknown instrumenter, then err", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--instrumenter", "asdf", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err == nil {
+			t.Errorf("expected exit code 1")
+		}
+	})
+
+	t.Run("when strip, then original", func(t *testing.T) {
+		tests := []struct {
+			instrumenter string
+			instrumented string
+			original     string
+		}{
+			{"opentelemetry", "./internal/testdata/instrumented/basic.go.exp", "./internal/testdata/basic.go"},
+			{"opentelemetry", "./internal/testdata/instrumented/basic_include_only.go.exp", "./internal/testdata/basic_include_only.go"},
+			{"opentelemetry", "./internal/testdata/instrumented/basic_patterns.go.exp", "./internal/testdata/basic_patterns.go"},
+			{"opentelemetry", "./internal/testdata/instrumented/directives.go.exp", "./internal/testdata/directives.go"},
+			{"opentelemetry", "./internal/testdata/instrumented/visibility.go.exp", "./internal/testdata/visibility.go"},
+			{"datadog", "./internal/testdata/instrumented/basic_datadog.go.exp", "./internal/testdata/basic.go"},
+		}
+		for _, tc := range tests {
+			f := copyFile(t, tc.instrumented)
+			cmd := exec.Command(testbin, "strip", "--app", "app", "-w", "--instrumenter", tc.instrumenter, f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+			assertEqFile(t, tc.original, f)
+		}
+	})
+
+	t.Run("when strip spans made by hand, then they are kept", func(t *testing.T) {
+		tests := []struct {
+			file     string
+			old, new string
+		}{
+			{"./internal/testdata/manual_update.go", "", ""},
+			{"./internal/testdata/instrumented/manual_update.go.exp", `"custom.handle"`, `"Handle"`},
+		}
+		for _, tc := range tests {
+			f := copyFile(t, tc.file)
+			cmd := exec.Command(testbin, "strip", "--app", "app", "-w", f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+
+			exp, _ := os.ReadFile("./internal/testdata/manual_update.go")
+			got, _ := os.ReadFile(f)
+			if s := strings.ReplaceAll(string(exp), tc.old, tc.new); s != string(got) {
+				t.Errorf("files are different: %s != %s", s, string(got))
+			}
+		}
+	})
+
+	t.Run("when strip other instrumenter, then unchanged", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/instrumented/basic_datadog.go.exp")
+		cmd := exec.Command(testbin, "strip", "--app", "app", "-w", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic_datadog.go.exp", f)
+	})
+
+	t.Run("when instrumented again, then unchanged", func(t *testing.T) {
+		tests := []struct {
+			instrumenter string
+			instrumented string
+		}{
+			{"opentelemetry", "./internal/testdata/instrumented/basic.go.exp"},
+			{"datadog", "./internal/testdata/instrumented/basic_datadog.go.exp"},
+		}
+		for _, tc := range tests {
+			f := copyFile(t, tc.instrumented)
+			cmd := exec.Command(testbin, "--app", "app", "-w", "--instrumenter", tc.instrumenter, f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+			assertEqFile(t, tc.instrumented, f)
+		}
+	})
+
+	t.Run("when instrumented again with other name, then spans kept", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/instrumented/basic.go.exp")
+		cmd := exec.Command(testbin, "--app", "other", "-w", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", f)
+	})
+
+	t.Run("when update spans with other name, then spans replaced", func(t *testing.T) {
+		tests := []struct {
+			instrumenter string
+			instrumented string
+			old, new     string
+		}{
+			{"opentelemetry", "./internal/testdata/instrumented/basic.go.exp", `otel.Tracer("app")`, `otel.Tracer("other")`},
+			{"datadog", "./internal/testdata/instrumented/basic_datadog.go.exp", `tracer.ServiceName("app")`, `tracer.ServiceName("other")`},
+		}
+		for _, tc := range tests {
+			f := copyFile(t, tc.instrumented)
+			cmd := exec.Command(testbin, "--app", "other", "-w", "--update-spans", "--instrumenter", tc.instrumenter, f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+
+			exp, _ := os.ReadFile(tc.instrumented)
+			got, _ := os.ReadFile(f)
+			if s := strings.ReplaceAll(string(exp), tc.old, tc.new); s != string(got) {
+				t.Errorf("files are different: %s != %s", s, string(got))
+			}
+
+			cmd = exec.Command(testbin, "strip", "--app", "other", "-w", "--instrumenter", tc.instrumenter, f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+			assertEqFile(t, "./internal/testdata/basic.go", f)
+		}
+	})
+
+	t.Run("when skip manual, then ok", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/manual.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--skip-manual", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/manual.go.exp", f)
+	})
+
+	t.Run("when update spans made by hand, then only span is replaced", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/manual_update.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--update-spans", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/manual_update.go.exp", f)
+	})
+
+	t.Run("when check instrumented, then ok", func(t *testing.T) {
+		cmd := exec.Command(testbin, "check", "--app", "app", "./internal/testdata/instrumented/basic.go.exp")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%s: %s", err, out)
+		}
+	})
+
+	t.Run("when check not instrumented, then err", func(t *testing.T) {
+		cmd := exec.Command(testbin, "check", "--app", "app", "./internal/testdata/manual.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err == nil {
+			t.Errorf("expected exit code 1")
+		}
+		if string(out) != "./internal/testdata/manual.go:24:6: NotManual missing span\n" {
+			t.Errorf("wrong output: %s", out)
+		}
+	})
+
+	t.Run("when check redacted, then listed", func(t *testing.T) {
+		cmd := exec.Command(testbin, "check", "--app", "app", "--types", "--config", "./internal/testdata/config/redact.yaml", "./internal/testdata/redact/redact.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err == nil {
+			t.Errorf("expected exit code 1")
+		}
+		exp := "./internal/testdata/redact/redact.go:15:6: Login missing span\n" +
+			"./internal/testdata/redact/redact.go:17:6: Logout missing span\n" +
+			"./internal/testdata/redact/redact.go:15:46: Login password is hashed\n" +
+			"./internal/testdata/redact/redact.go:15:63: Login token is hashed\n" +
+			"./internal/testdata/redact/redact.go:15:76: Login creds is hashed\n"
+		if string(out) != exp {
+			t.Errorf("wrong output: %s", out)
+		}
+	})
+
+	t.Run("when redact, then sensitive attributes hashed", func(t *testing.T) {
+		cmd := exec.Command(testbin, "--app", "app", "--types", "--config", "./internal/testdata/config/redact.yaml", "./internal/testdata/redact/redact.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		exp, _ := os.ReadFile("./internal/testdata/instrumented/redact.go.exp")
+		if string(exp) != string(out) {
+			t.Errorf("files are different: %s != %s", exp, out)
+		}
+	})
+
+	t.Run("when list, then changed files", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		g := copyFile(t, "./internal/testdata/instrumented/basic.go.exp")
+		cmd := exec.Command(testbin, "--app", "app", "--list", f, g)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		if string(out) != f+"\n" {
+			t.Errorf("wrong list: %s", out)
+		}
+		assertEqFile(t, "./internal/testdata/basic.go", f)
+	})
+
+	t.Run("when diff, then diff of changes", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "--diff", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		for _, s := range []string{"--- " + f + ".orig\n+++ " + f + "\n", "\n+\t_, span := otel.Tracer(\"app\").Start(ctx, \"Cat.Name\")\n"} {
+			if !strings.Contains(string(out), s) {
+				t.Errorf("expected %q in diff: %s", s, out)
+			}
+		}
+		assertEqFile(t, "./internal/testdata/basic.go", f)
+	})
+
+	t.Run("when overlay, then instrumented copy", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		dir := t.TempDir()
+		cmd := exec.Command(testbin, "--app", "app", "--overlay", path.Join(dir, "overlay.json"), "--overlay-dir", path.Join(dir, "cache"), f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/basic.go", f)
+		assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", path.Join(dir, "cache", f))
+
+		overlay, _ := os.ReadFile(path.Join(dir, "overlay.json"))
+		if !strings.Contains(string(overlay), `"`+f+`": "`+path.Join(dir, "cache", f)+`"`) {
+			t.Errorf("wrong overlay: %s", overlay)
+		}
+	})
+
+	t.Run("when overlay and overwrite, then err", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--overlay", path.Join(t.TempDir(), "overlay.json"), f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err == nil {
+			t.Errorf("expected exit code 1")
+		}
+	})
+
+	t.Run("when types, then context matched by type", func(t *testing.T) {
+		cmd := exec.Command(testbin, "--app", "app", "--types", "./internal/testdata/typed/typed.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		exp, _ := os.ReadFile("./internal/testdata/instrumented/typed.go.exp")
+		if string(exp) != string(out) {
+			t.Errorf("files are different: %s != %s", exp, out)
+		}
+	})
+
+	t.Run("when panic command, then panic recorded", func(t *testing.T) {
+		cmd := exec.Command(testbin, "--app", "app", "./internal/testdata/panic.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		exp, _ := os.ReadFile("./internal/testdata/instrumented/panic.go.exp")
+		if string(exp) != string(out) {
+			t.Errorf("files are different: %s != %s", exp, out)
+		}
+	})
+
+	t.Run("when return attributes, then named results recorded", func(t *testing.T) {
+		cmd := exec.Command(testbin, "--app", "app", "--return-attrs", "./internal/testdata/basic.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		exp, _ := os.ReadFile("./internal/testdata/instrumented/basic_return_attrs.go.exp")
+		if string(exp) != string(out) {
+			t.Errorf("files are different: %s != %s", exp, out)
+		}
+	})
+
+	t.Run("when name results, then errors recorded", func(t *testing.T) {
+		cmd := exec.Command(testbin, "--app", "app", "--name-results", "./internal/testdata/basic.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		exp, _ := os.ReadFile("./internal/testdata/instrumented/basic_name_results.go.exp")
+		if string(exp) != string(out) {
+			t.Errorf("files are different: %s != %s", exp, out)
+		}
+	})
+
 	t.Run("when include only, then ok", func(t *testing.T) {
 		f := copyFile(t, "./internal/testdata/basic_include_only.go")
 		cmd := exec.Command(testbin, "--app", "app", "-w", "--default-select=false", f)
 		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
 		if err := cmd.Run(); err != nil {
-			t.Errorf(err.Error())
+			t.Error(err)
 		}
 		assertEqFile(t, "./internal/testdata/instrumented/basic_include_only.go.exp", f)
 	})
 
+	t.Run("when include patterns, then ok", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/basic_patterns.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--default-select=false", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic_patterns.go.exp", f)
+	})
+
+	t.Run("when function directives, then ok", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/directives.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/directives.go.exp", f)
+	})
+
+	t.Run("when function directives and name results, then ok", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/directives.go")
+		cmd := exec.Command(testbin, "--app", "app", "--name-results", "-w", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/directives_name_results.go.exp", f)
+	})
+
+	t.Run("when rules in config file of project, then ok", func(t *testing.T) {
+		cmd := exec.Command(testbin, "--app", "app", "./internal/testdata/rules/rules.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		exp, _ := os.ReadFile("./internal/testdata/instrumented/rules.go.exp")
+		if string(exp) != string(out) {
+			t.Errorf("files are different: %s != %s", exp, out)
+		}
+	})
+
+	t.Run("when exported visibility, then only public API", func(t *testing.T) {
+		f := copyFile(t, "./internal/testdata/visibility.go")
+		cmd := exec.Command(testbin, "--app", "app", "-w", "--visibility=exported", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/visibility.go.exp", f)
+	})
+
+	t.Run("when toolexec, then built program is instrumented", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("builds program")
+		}
+
+		dir := t.TempDir()
+		os.WriteFile(path.Join(dir, "go.mod"), []byte("module example\n\ngo 1.21\n"), 0644)
+		os.WriteFile(path.Join(dir, "main.go"), []byte(`package main
+
+import "context"
+
+func Hello(ctx context.Context) {}
+
+func main() { Hello(context.Background()) }
+`), 0644)
+		// log is not imported by program, so linker has to get it from instrumented package
+		os.WriteFile(path.Join(dir, "config.yaml"), []byte(`instrumenter: template
+template:
+  imports:
+    - path: log
+  prefix: |
+    log.Println("span", "{{.SpanName}}")
+`), 0644)
+
+		// second build links package compiled by first one
+		builds := []struct {
+			exe   string
+			flags []string
+			cgo   bool
+		}{
+			{exe: "first"},
+			{exe: "second"},
+			// imports of instrumentation are built with flags of build
+			{exe: "race", flags: []string{"-race"}, cgo: true},
+		}
+		cgo, _ := exec.Command("go", "env", "CGO_ENABLED").Output()
+		for _, tc := range builds {
+			if tc.cgo && strings.TrimSpace(string(cgo)) != "1" {
+				continue
+			}
+			exe := tc.exe
+			args := append([]string{"build"}, tc.flags...)
+			build := exec.Command("go", append(args, "-toolexec", testbin+" toolexec --app app --config "+path.Join(dir, "config.yaml"), "-o", exe, ".")...)
+			build.Dir = dir
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("%s: %s", err, out)
+			}
+
+			out, err := exec.Command(path.Join(dir, exe)).CombinedOutput()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(out), "span Hello") {
+				t.Errorf("expected span in output: %s", out)
+			}
+		}
+	})
+
+	t.Run("when toolexec with rules, then rules are matched by source files", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("builds program")
+		}
+
+		dir := t.TempDir()
+		os.WriteFile(path.Join(dir, "go.mod"), []byte("module example\n\ngo 1.21\n"), 0644)
+		os.MkdirAll(path.Join(dir, "greet"), 0755)
+		os.WriteFile(path.Join(dir, "greet", "greet.go"), []byte(`package greet
+
+import "context"
+
+func Greet(ctx context.Context) {}
+`), 0644)
+		os.WriteFile(path.Join(dir, "skipped.go"), []byte(`package main
+
+import "context"
+
+func Skipped(ctx context.Context) {}
+`), 0644)
+		os.WriteFile(path.Join(dir, "main.go"), []byte(`package main
+
+import (
+	"context"
+
+	"example/greet"
+)
+
+func Hello(ctx context.Context) {}
+
+func main() {
+	Hello(context.Background())
+	Skipped(context.Background())
+	greet.Greet(context.Background())
+}
+`), 0644)
+		// files are compiled from copies, while rules are of packages and files of source
+		os.WriteFile(path.Join(dir, "config.yaml"), []byte(`instrumenter: template
+template:
+  imports:
+    - path: log
+  prefix: |
+    log.Println("span", "{{.SpanName}}")
+rules:
+  - action: exclude
+    package: example/greet
+  - action: exclude
+    file: skipped.go
+`), 0644)
+
+		build := exec.Command("go", "build", "-toolexec", testbin+" toolexec --app app --config "+path.Join(dir, "config.yaml"), "-o", "rules", ".")
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+
+		out, err := exec.Command(path.Join(dir, "rules")).CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), "span Hello") {
+			t.Errorf("expected span in output: %s", out)
+		}
+		for _, s := range []string{"span Greet", "span Skipped"} {
+			if strings.Contains(string(out), s) {
+				t.Errorf("expected no %s in output: %s", s, out)
+			}
+		}
+	})
+
 	t.Run("when generated file, then err", func(t *testing.T) {
 		cmd := exec.Command(testbin, "--app", "app", "-w", "--skip-generated=true", "./internal/testdata/skipped_generated.go")
 		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
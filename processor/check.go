@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"os"
+	"strconv"
+)
+
+// Finding is function that has to be instrumented, but it is not.
+type Finding struct {
+	Pos      token.Pos
+	Position token.Position
+	SpanName string
+
+	// Edits insert statements of Instrumenter.
+	// Imports that file is missing for statements are inserted by edits too, same for every finding.
+	Edits []TextEdit
+}
+
+func (f Finding) String() string { return fmt.Sprintf("%s: %s missing span", f.Position, f.SpanName) }
+
+// TextEdit replaces text from Pos to End with NewText.
+type TextEdit struct {
+	Pos     token.Pos
+	End     token.Pos
+	NewText []byte
+}
+
+// Check reports functions that would be instrumented by Process, and redactions of attributes of functions.
+func (p *TraceProcessor) Check(fileName string, config ...any) ([]Finding, []Redaction, error) {
+	var (
+		conf TraceConfig = DefaultTraceConfig
+		ok   bool
+	)
+
+	if len(config) != 0 {
+		conf, ok = config[0].(TraceConfig)
+		if !ok {
+			return nil, nil, ErrInvalidConfigType
+		}
+	}
+
+	fset, file, info, err := parseCheckedFile(fileName, conf)
+	if err != nil || file == nil {
+		return nil, nil, err
+	}
+
+	return p.CheckFile(fset, file, info, conf)
+}
+
+// parseCheckedFile as it is, since positions are reported in it, with types in type-checked mode.
+// File is nil when it has to be skipped.
+func parseCheckedFile(fileName string, conf TraceConfig) (*token.FileSet, *ast.File, *types.Info, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fset, file, err := parseSource(fileName, src, conf)
+	if err != nil || file == nil {
+		return nil, nil, nil, err
+	}
+
+	collectPackages(&conf)
+	info, err := typesInfo(fileName, file, conf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return fset, file, info, nil
+}
+
+// CheckFile reports functions of parsed file that would be instrumented by Process.
+// Context is matched by types of file when they are set.
+// Functions with spans made by hand are instrumented, when Instrumenter can detect them.
+// Redactions are reported for all functions that would be instrumented, whether they are instrumented or not.
+func (p *TraceProcessor) CheckFile(fset *token.FileSet, file *ast.File, info *types.Info, config ...any) ([]Finding, []Redaction, error) {
+	var (
+		conf TraceConfig = DefaultTraceConfig
+		ok   bool
+	)
+
+	if len(config) != 0 {
+		conf, ok = config[0].(TraceConfig)
+		if !ok {
+			return nil, nil, ErrInvalidConfigType
+		}
+	}
+
+	if err := p.selectFunctions(fset.Position(file.Pos()).Filename, file, conf); err != nil {
+		return nil, nil, err
+	}
+
+	newInstrumenter, err := p.instrumenter(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// functions with spans made by hand are not reported
+	conf.SkipManual = true
+	fns, err := p.uninstrumented(fset, file, info, newInstrumenter, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var findings []Finding
+	for _, q := range fns {
+		if q.end.IsValid() {
+			// function has span, which is only renamed by Process
+			continue
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("\n")
+		if err := format.Node(&buf, token.NewFileSet(), q.stmts); err != nil {
+			return nil, nil, err
+		}
+		buf.WriteString("\n")
+
+		// each fix adds imports it needs, and same imports of many fixes are same edits
+		missing, err := missingImports(fset, file, fset.Position(file.Pos()).Filename, q.imports)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lbrace := q.fn.body.Lbrace + 1
+		findings = append(findings, Finding{
+			Pos:      q.fn.pos,
+			Position: fset.Position(q.fn.pos),
+			SpanName: p.spanName(q.fn),
+			Edits:    append(importEdits(file, missing), TextEdit{Pos: lbrace, End: lbrace, NewText: buf.Bytes()}),
+		})
+	}
+
+	return findings, p.redactions(fset, p.selected(fset, file, info), info, conf), nil
+}
+
+// importEdits adds packages to file, see missingImports.
+// Imports are added to first import declaration with parentheses, or else as new declarations after package clause.
+// Each package is added by its own edit, so that edits of fixes that add same package are same and are merged by tools that apply them.
+func importEdits(file *ast.File, pkgs []*types.Package) []TextEdit {
+	var lparen token.Pos
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT && d.Lparen.IsValid() {
+			lparen = d.Lparen
+			break
+		}
+	}
+
+	var edits []TextEdit
+	for _, pkg := range pkgs {
+		spec := strconv.Quote(pkg.Path())
+		if name := importName(pkg); name != "" {
+			spec = name + " " + spec
+		}
+		if lparen.IsValid() {
+			edits = append(edits, TextEdit{Pos: lparen + 1, End: lparen + 1, NewText: []byte("\n\t" + spec)})
+		} else {
+			edits = append(edits, TextEdit{Pos: file.Name.End(), End: file.Name.End(), NewText: []byte("\n\nimport " + spec)})
+		}
+	}
+	return edits
+}
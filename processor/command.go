@@ -3,6 +3,7 @@ package processor
 import (
 	"errors"
 	"go/ast"
+	"go/token"
 	"strings"
 )
 
@@ -10,16 +11,33 @@ const (
 	commandPrefix            = `//instrument:`
 	commandIncludeIdentifier = `//instrument:include`
 	commandExcludeIdentifier = `//instrument:exclude`
+	commandAttrsIdentifier   = `//instrument:attrs`
+	commandPanicIdentifier   = `//instrument:panic`
+	commandSkipIdentifier    = `//instrument:skip`
+	commandSpanIdentifier    = `//instrument:span`
 )
 
+var ErrCommandNotInFunctionDoc = errors.New("command is not in doc comment of function")
+
 // Command to change behavior of Processor or Instrumentor
 type Command struct {
 	acceptFunctions map[string]bool
+	includePatterns []FunctionPattern
+	excludePatterns []FunctionPattern
+	panicFunctions  map[string]bool
+
+	// commands in doc comment of function apply to function with name at position
+	function token.Pos
+	skip     bool
+	spanName string
 }
 
+// isFunctionCommand when command applies only to function of doc comment it is in.
+func (c Command) isFunctionCommand() bool { return c.skip || c.spanName != "" }
+
 // ParseCommand from string representation
 func ParseCommand(s string) (Command, error) {
-	command := Command{acceptFunctions: map[string]bool{}}
+	command := Command{acceptFunctions: map[string]bool{}, panicFunctions: map[string]bool{}}
 
 	if !strings.HasPrefix(s, commandPrefix) {
 		return command, nil
@@ -27,23 +45,88 @@ func ParseCommand(s string) (Command, error) {
 
 	switch {
 	case strings.HasPrefix(s, commandIncludeIdentifier):
-		for _, v := range strings.Split(strings.TrimSpace(s[len(commandIncludeIdentifier):]), "|") {
-			command.acceptFunctions[v] = true
+		for _, v := range splitFunctions(strings.TrimSpace(s[len(commandIncludeIdentifier):])) {
+			pattern, ok, err := parseFunctionPattern(v)
+			if err != nil {
+				return command, err
+			}
+			if ok {
+				command.includePatterns = append(command.includePatterns, pattern)
+			} else {
+				command.acceptFunctions[v] = true
+			}
 		}
 	case strings.HasPrefix(s, commandExcludeIdentifier):
-		for _, v := range strings.Split(strings.TrimSpace(s[len(commandExcludeIdentifier):]), "|") {
-			command.acceptFunctions[v] = false
+		for _, v := range splitFunctions(strings.TrimSpace(s[len(commandExcludeIdentifier):])) {
+			pattern, ok, err := parseFunctionPattern(v)
+			if err != nil {
+				return command, err
+			}
+			if ok {
+				command.excludePatterns = append(command.excludePatterns, pattern)
+			} else {
+				command.acceptFunctions[v] = false
+			}
+		}
+	case strings.HasPrefix(s, commandPanicIdentifier):
+		for _, v := range strings.Split(strings.TrimSpace(s[len(commandPanicIdentifier):]), "|") {
+			command.panicFunctions[v] = true
 		}
+	case strings.HasPrefix(s, commandAttrsIdentifier):
+		// attributes are in doc comments of functions, see attrsFromDoc
+	case s == commandSkipIdentifier:
+		command.skip = true
+	case strings.HasPrefix(s, commandSpanIdentifier+" "):
+		name, ok := strings.CutPrefix(strings.TrimSpace(s[len(commandSpanIdentifier):]), "name=")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return command, errors.New("span command expects name=<span name>")
+		}
+		command.spanName = name
 	default:
 		return command, errors.New("unkown command")
 	}
 	return command, nil
 }
 
-// CommandsFromFile that has been parsed by `go/parse` with comments
+// splitFunctions by |, which does not split patterns inside of parentheses or brackets, eg re:^(Get|Put)$.
+func splitFunctions(s string) []string {
+	var q []string
+	depth, start := 0, 0
+	inBrackets, escaped := false, false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case inBrackets:
+			inBrackets = r != ']'
+		case r == '[':
+			inBrackets = true
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == '|' && depth == 0:
+			q = append(q, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(q, s[start:])
+}
+
+// CommandsFromFile that has been parsed by `go/parse` with comments.
+// Commands of single function are bound to function of doc comment they are in.
 func CommandsFromFile(file ast.File) ([]Command, error) {
 	var commands []Command
 
+	docs := make(map[*ast.CommentGroup]*ast.FuncDecl)
+	for _, q := range file.Decls {
+		if fn, ok := q.(*ast.FuncDecl); ok && fn.Doc != nil {
+			docs[fn.Doc] = fn
+		}
+	}
+
 	for _, q := range file.Comments {
 		if q == nil {
 			continue
@@ -58,6 +141,13 @@ func CommandsFromFile(file ast.File) ([]Command, error) {
 			if err != nil {
 				return nil, err
 			}
+			if c.isFunctionCommand() {
+				fn, ok := docs[q]
+				if !ok {
+					return nil, ErrCommandNotInFunctionDoc
+				}
+				c.function = fn.Name.Pos()
+			}
 			commands = append(commands, c)
 		}
 	}
@@ -80,7 +170,62 @@ func NewMapFunctionSelectorFromCommands(defaultSelect bool, commands []Command)
 				f.AcceptFunctions[fname] = accept
 			}
 		}
+		f.IncludePatterns = append(f.IncludePatterns, q.includePatterns...)
+		f.ExcludePatterns = append(f.ExcludePatterns, q.excludePatterns...)
+		if q.skip {
+			if f.SkipFunctions == nil {
+				f.SkipFunctions = map[token.Pos]bool{}
+			}
+			f.SkipFunctions[q.function] = true
+		}
 	}
 
 	return f
 }
+
+// SpanNamesFromCommands are names of spans by position of names of functions, that are set in doc comments of functions.
+func SpanNamesFromCommands(commands []Command) map[token.Pos]string {
+	names := map[token.Pos]string{}
+	for _, q := range commands {
+		if q.spanName != "" {
+			names[q.function] = q.spanName
+		}
+	}
+	return names
+}
+
+// NewPanicFunctionSelectorFromCommands selects functions where panics are recorded, which are all when recordPanic is set.
+func NewPanicFunctionSelectorFromCommands(recordPanic bool, commands []Command) MapFunctionSelector {
+	f := MapFunctionSelector{
+		AcceptFunctions: map[string]bool{},
+		Default:         recordPanic,
+	}
+
+	for _, q := range commands {
+		for fname, accept := range q.panicFunctions {
+			f.AcceptFunctions[fname] = accept
+		}
+	}
+
+	return f
+}
+
+// attrsFromDoc are names of parameters in `//instrument:attrs a,b` directive of function doc comment.
+// All parameters are used when directive has no names. Parameters are not used when there is no directive.
+func attrsFromDoc(doc *ast.CommentGroup) (names []string, ok bool) {
+	if doc == nil {
+		return nil, false
+	}
+	for _, c := range doc.List {
+		if c == nil || !strings.HasPrefix(c.Text, commandAttrsIdentifier) {
+			continue
+		}
+		for _, v := range strings.Split(c.Text[len(commandAttrsIdentifier):], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				names = append(names, v)
+			}
+		}
+		return names, true
+	}
+	return nil, false
+}
@@ -14,6 +14,12 @@ func TestParseCommand_Error(t *testing.T) {
 		"//instrument:",
 		"//instrument: asdf",
 		"//instrument:asdf",
+		"//instrument:include re:(",
+		"//instrument:exclude glob:[",
+		"//instrument:span",
+		"//instrument:span name=",
+		"//instrument:span id=pay",
+		"//instrument:skip Name",
 	}
 	for i, tc := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
@@ -28,6 +34,7 @@ func TestParseCommand_Error(t *testing.T) {
 func TestParseCommandFromFile_Error(t *testing.T) {
 	tests := []string{
 		"testdata/bad_command_unknown.go",
+		"testdata/bad_command_skip_not_in_doc.go",
 	}
 	for i, tc := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
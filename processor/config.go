@@ -1,19 +1,84 @@
 package processor
 
+import "github.com/nikolaydubina/go-instrument/instrument"
+
 var (
 	DefaultTraceConfig TraceConfig = TraceConfig{
 		App:           "app",
+		Instrumenter:  instrument.NameOpenTelemetry,
 		Overwrite:     false,
 		DefaultSelect: true,
 		SkipGenerated: false,
+		SkipManual:    false,
 	}
 )
 
 type TraceConfig struct {
 	App           string
+	Instrumenter  string
 	Overwrite     bool
 	DefaultSelect bool
 	SkipGenerated bool
+	SkipManual    bool
+
+	// UpdateSpans replaces statements inserted before that differ from ones that would be inserted now, eg by span name after function is renamed.
+	// Otherwise, functions with such statements are skipped.
+	UpdateSpans bool
+
+	// Types enables matching of context by type, with packages of files loaded by go/packages.
+	Types bool
+
+	// RecordPanic records panics in spans of all functions, otherwise only in functions of `//instrument:panic` command.
+	RecordPanic bool
+
+	// ReturnAttributes records named results in span attributes.
+	ReturnAttributes bool
+
+	// IgnoreErrors are expected errors, which do not set error status of span.
+	IgnoreErrors []instrument.ErrorMatcher
+
+	// Redact parameters and results that are sensitive, when they are recorded in span attributes.
+	Redact RedactPolicy
+
+	// Rules of project select functions before commands in files.
+	Rules RuleSet
+
+	// Visibility of functions that are instrumented, which are all when it is empty.
+	Visibility Visibility
+
+	// NameResults of functions with unnamed error results, so that errors are recorded.
+	NameResults bool
+
+	// List names of files that are changed and Diff of changes, instead of printing files.
+	// Files are still written when Overwrite or Overlay is set.
+	List bool
+	Diff bool
+
+	// SourceFile is file that processed file is copy of, eg in toolexec, by which rules and package of file are found.
+	SourceFile string
+
+	// Overlay is file where replacements of `go build -overlay` are written, instead of writing files.
+	// Instrumented copies of files are written to OverlayDir.
+	Overlay    string
+	OverlayDir string
+
+	overlay  *overlay
+	packages *packageIndex
+}
+
+// sourceName is name of file that rules and package of processed file are found by.
+func (c TraceConfig) sourceName(fileName string) string {
+	if c.SourceFile != "" {
+		return c.SourceFile
+	}
+	return fileName
+}
+
+func (c TraceConfig) instrumentConfig() instrument.Config {
+	return instrument.Config{
+		App:          c.App,
+		IgnoreErrors: c.IgnoreErrors,
+	}
 }
 
 type LicenseConfig struct {
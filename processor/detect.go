@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"go/types"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+// inserted is statements at the top of body that Instrumenter has inserted.
+type inserted struct {
+	// n is number of statements, or zero if there are none.
+	n int
+
+	// stale when statements differ from ones that would be inserted now, eg by span name, and have to be replaced.
+	stale bool
+
+	// imports of statements as they would be inserted now.
+	imports []*types.Package
+}
+
+// matchInserted finds statements at the top of body that are same as would be inserted, or else are same but for string literals.
+// Context is used by inserted statements, so statements with context assigned and with context left out are matched both.
+// New Instrumenter is made for each try, so that statements that are not inserted do not change its imports.
+func matchInserted(fset *token.FileSet, body *ast.BlockStmt, fn instrument.Function, newInstrumenter func() Instrumenter) (inserted, error) {
+	if body == nil || len(body.List) == 0 {
+		return inserted{}, nil
+	}
+
+	var tries [][]ast.Stmt
+	var imports [][]*types.Package
+	for _, unused := range []bool{false, true} {
+		fn.UnusedContext = unused
+		instrumenter := newInstrumenter()
+		stmts, err := instrumenter.PrefixStatements(fn)
+		if err != nil {
+			return inserted{}, err
+		}
+		if n := matchPrefix(fset, body, stmts); n > 0 {
+			return inserted{n: n, imports: instrumenter.Imports()}, nil
+		}
+		tries = append(tries, stmts)
+		imports = append(imports, instrumenter.Imports())
+	}
+
+	for i, stmts := range tries {
+		if n := matchStale(fset, body, stmts); n > 0 {
+			return inserted{n: n, stale: true, imports: imports[i]}, nil
+		}
+	}
+	return inserted{}, nil
+}
+
+// matchPrefix returns number of statements at the top of body that are same as stmts, or zero if not all of them match.
+func matchPrefix(fset *token.FileSet, body *ast.BlockStmt, stmts []ast.Stmt) int {
+	if len(stmts) == 0 || body == nil || len(body.List) < len(stmts) {
+		return 0
+	}
+
+	for i, stmt := range stmts {
+		exp, err := formatNodeToBytes(token.NewFileSet(), stmt)
+		if err != nil {
+			return 0
+		}
+		got, err := formatNodeToBytes(fset, body.List[i])
+		if err != nil {
+			return 0
+		}
+		if !bytes.Equal(exp, got) {
+			return 0
+		}
+	}
+
+	return len(stmts)
+}
+
+// matchStale returns number of statements at the top of body that were inserted with other string literals, eg span name, or zero if there are none.
+// First statement has to be same as first of stmts but for single string literal, so that spans made by hand with other tracer are not matched.
+// It is followed by statements on next lines that are same as rest of stmts but for string literals.
+// Other statements are never matched, since they are written by hand, eg attributes of span.
+func matchStale(fset *token.FileSet, body *ast.BlockStmt, stmts []ast.Stmt) int {
+	if len(stmts) == 0 {
+		return 0
+	}
+	if d := diffStrings(fset, body.List[0], stmts[0]); d < 0 || d > 1 {
+		return 0
+	}
+
+	n := 1
+	for ; n < len(body.List) && n < len(stmts); n++ {
+		stmt := body.List[n]
+		if fset.Position(stmt.Pos()).Line != fset.Position(body.List[n-1].End()).Line+1 {
+			break
+		}
+		if !sameShape(fset, stmt, stmts[n]) {
+			break
+		}
+	}
+	return n
+}
+
+// sameShape when statements are same but for string literals.
+func sameShape(fset *token.FileSet, stmt, exp ast.Stmt) bool {
+	return diffStrings(fset, stmt, exp) >= 0
+}
+
+// diffStrings is number of string literals that differ in statements, or -1 when statements differ otherwise.
+func diffStrings(fset *token.FileSet, stmt, exp ast.Stmt) int {
+	got, err := tokens(fset, stmt)
+	if err != nil {
+		return -1
+	}
+	want, err := tokens(token.NewFileSet(), exp)
+	if err != nil || len(got) != len(want) {
+		return -1
+	}
+
+	n := 0
+	for i := range got {
+		switch {
+		case got[i] == want[i]:
+		case got[i].tok == token.STRING && want[i].tok == token.STRING:
+			n++
+		default:
+			return -1
+		}
+	}
+	return n
+}
+
+type tokenLit struct {
+	tok token.Token
+	lit string
+}
+
+// tokens of formatted node.
+func tokens(fset *token.FileSet, node ast.Node) ([]tokenLit, error) {
+	src, err := formatNodeToBytes(fset, node)
+	if err != nil {
+		return nil, err
+	}
+
+	var s scanner.Scanner
+	s.Init(token.NewFileSet().AddFile("", -1, len(src)), src, nil, 0)
+
+	var q []tokenLit
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return q, nil
+		}
+		q = append(q, tokenLit{tok: tok, lit: lit})
+	}
+}
@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// diffContext is number of unchanged lines around changes in hunk.
+const diffContext = 3
+
+type diffLine struct {
+	kind byte // ' ' unchanged, '-' removed, '+' added
+	text string
+}
+
+// diff is unified diff of files, in same format as `gofmt -d`.
+// Diff is empty when files are equal.
+func diff(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+
+	lines := diffLines(splitLines(old), splitLines(new))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "diff %s %s\n--- %s\n+++ %s\n", oldName, newName, oldName, newName)
+
+	// number of old and new lines before each line
+	oldLine, newLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, q := range lines {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if q.kind != '+' {
+			oldLine[i+1]++
+		}
+		if q.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i, prevEnd := 0, 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// changes that are close to each other are in same hunk
+		start, end := max(i-diffContext, prevEnd), i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(lines))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]),
+			hunkRange(newLine[start], newLine[end]-newLine[start]),
+		)
+		for _, q := range lines[start:end] {
+			out.WriteByte(q.kind)
+			out.WriteString(q.text)
+			if len(q.text) == 0 || q.text[len(q.text)-1] != '\n' {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		prevEnd, i = end, end
+	}
+
+	return out.Bytes()
+}
+
+// hunkRange starts from line before hunk when hunk has no lines.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines keeps line endings, so that missing newline at end of file is visible.
+func splitLines(b []byte) []string {
+	var lines []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			i = len(b)
+		}
+		lines = append(lines, string(b[:i]))
+		b = b[i:]
+	}
+	return lines
+}
+
+// diffLines of files anchored on lines that are unique in both files, in same way as `gofmt -d`.
+// Anchors in same order in both files are found by longest increasing subsequence, then they are expanded to equal lines around them.
+// It takes linear memory, and it is exact for instrumentation, which only inserts lines that are not unique.
+func diffLines(a, b []string) []diffLine {
+	var lines []diffLine
+	var done diffPair
+	for _, q := range diffAnchors(a, b) {
+		if q.x < done.x {
+			// anchor is among equal lines of previous one
+			continue
+		}
+
+		start := q
+		for start.x > done.x && start.y > done.y && a[start.x-1] == b[start.y-1] {
+			start.x--
+			start.y--
+		}
+		end := q
+		for end.x < len(a) && end.y < len(b) && a[end.x] == b[end.y] {
+			end.x++
+			end.y++
+		}
+
+		for _, s := range a[done.x:start.x] {
+			lines = append(lines, diffLine{kind: '-', text: s})
+		}
+		for _, s := range b[done.y:start.y] {
+			lines = append(lines, diffLine{kind: '+', text: s})
+		}
+		for _, s := range a[start.x:end.x] {
+			lines = append(lines, diffLine{kind: ' ', text: s})
+		}
+		done = end
+	}
+	return lines
+}
+
+// diffPair is index of line in each file.
+type diffPair struct{ x, y int }
+
+// diffAnchors are lines that are unique in both files and are in same order in them, from start to end of files.
+func diffAnchors(a, b []string) []diffPair {
+	// count is -1 for each line in a and -4 for each line in b, up to two of them, so that unique lines have -5
+	count := make(map[string]int)
+	for _, s := range a {
+		if c := count[s]; c > -2 {
+			count[s] = c - 1
+		}
+	}
+	for _, s := range b {
+		if c := count[s]; c > -8 {
+			count[s] = c - 4
+		}
+	}
+
+	// unique lines of b get their index in by, and lines of a are listed by these indices in order of a
+	var ax, by, order []int
+	for i, s := range b {
+		if count[s] == -5 {
+			count[s] = len(by)
+			by = append(by, i)
+		}
+	}
+	for i, s := range a {
+		if j, ok := count[s]; ok && j >= 0 {
+			ax = append(ax, i)
+			order = append(order, j)
+		}
+	}
+
+	// longest increasing subsequence of order, tails[k] is smallest last element of subsequence of length k+1
+	var tails []int
+	length := make([]int, len(order))
+	for i, j := range order {
+		k, _ := slices.BinarySearch(tails, j)
+		if k == len(tails) {
+			tails = append(tails, j)
+		} else {
+			tails[k] = j
+		}
+		length[i] = k + 1
+	}
+
+	anchors := make([]diffPair, len(tails)+2)
+	anchors[len(anchors)-1] = diffPair{len(a), len(b)}
+	k, last := len(tails), len(by)
+	for i := len(order) - 1; i >= 0 && k > 0; i-- {
+		if length[i] == k && order[i] < last {
+			anchors[k] = diffPair{ax[i], by[order[i]]}
+			last = order[i]
+			k--
+		}
+	}
+	return anchors
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		exp  string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			exp:  "",
+		},
+		{
+			name: "insert",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "1\n2\n3\n4\nx\n5\n6\n7\n8\n",
+			exp:  "diff f.orig f\n--- f.orig\n+++ f\n@@ -2,6 +2,7 @@\n 2\n 3\n 4\n+x\n 5\n 6\n 7\n",
+		},
+		{
+			name: "delete",
+			old:  "1\nx\n2\n",
+			new:  "1\n2\n",
+			exp:  "diff f.orig f\n--- f.orig\n+++ f\n@@ -1,3 +1,2 @@\n 1\n-x\n 2\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "x\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\ny\n",
+			exp:  "diff f.orig f\n--- f.orig\n+++ f\n@@ -1,3 +1,4 @@\n+x\n 1\n 2\n 3\n@@ -8,3 +9,4 @@\n 8\n 9\n 10\n+y\n",
+		},
+		{
+			name: "no newline at end of file",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			exp:  "diff f.orig f\n--- f.orig\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(diff("f.orig", []byte(tc.old), "f", []byte(tc.new))); got != tc.exp {
+				t.Errorf("got:\n%s\nexp:\n%s", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestDiff_LargeFile(t *testing.T) {
+	var old, new bytes.Buffer
+	old.WriteString("package example\n")
+	new.WriteString("package example\n")
+	for i := range 3000 {
+		fn := fmt.Sprintf("\nfunc F%d(ctx context.Context) {\n\treturn\n}\n", i)
+		old.WriteString(fn)
+		new.WriteString(strings.Replace(fn, "{\n", "{\n\t_, span := otel.Tracer(\"app\").Start(ctx, \"F\")\n\tdefer span.End()\n\n", 1))
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	out := diff("f.orig", old.Bytes(), "f", new.Bytes())
+	runtime.ReadMemStats(&after)
+
+	if n := strings.Count(string(out), "\n+\t"); n != 6000 {
+		t.Errorf("expected 6000 added lines, got %d", n)
+	}
+	if n := strings.Count(string(out), "\n-"); n != 1 {
+		t.Errorf("expected no removed lines, got %d", n-1)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Errorf("expected memory linear in size of files, got %d bytes", alloc)
+	}
+}
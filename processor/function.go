@@ -0,0 +1,237 @@
+package processor
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+// function is declaration or literal of function that can be instrumented.
+type function struct {
+	pos      token.Pos
+	receiver string
+	name     string
+	fnType   *ast.FuncType
+	body     *ast.BlockStmt
+	doc      *ast.CommentGroup
+
+	pointer  bool
+	literal  bool
+	pkg      string
+	position token.Position
+
+	// file that function is declared in
+	file *ast.File
+
+	// enclosing declaration of literal
+	enclosing *function
+}
+
+// functionsFromFile in order of appearance. Functions without body are skipped.
+func functionsFromFile(fset *token.FileSet, file *ast.File) []function {
+	var fns []function
+
+	for _, q := range file.Decls {
+		// literals are in declaration of function, or else in declaration of package
+		var decl *function
+
+		ast.Inspect(q, func(n ast.Node) bool {
+			switch fn := n.(type) {
+			case *ast.FuncLit:
+				fns = append(fns, function{
+					pos:       fn.Pos(),
+					name:      "anonymous",
+					fnType:    fn.Type,
+					body:      fn.Body,
+					literal:   true,
+					pkg:       file.Name.Name,
+					position:  fset.Position(fn.Pos()),
+					file:      file,
+					enclosing: decl,
+				})
+			case *ast.FuncDecl:
+				if fn.Body == nil {
+					return false
+				}
+				decl = &function{
+					pos:      fn.Name.Pos(),
+					receiver: methodReceiverTypeName(fn),
+					name:     functionName(fn),
+					fnType:   fn.Type,
+					body:     fn.Body,
+					doc:      fn.Doc,
+					pointer:  isPointerReceiver(fn),
+					pkg:      file.Name.Name,
+					position: fset.Position(fn.Name.Pos()),
+					file:     file,
+				}
+				fns = append(fns, *decl)
+			}
+			return true
+		})
+	}
+
+	return fns
+}
+
+// info of function for FunctionSelector.
+func (fn function) info() FunctionInfo {
+	info := FunctionInfo{
+		Package:  fn.pkg,
+		Receiver: fn.receiver,
+		Pointer:  fn.pointer,
+		Name:     fn.name,
+		Literal:  fn.literal,
+		Pos:      fn.pos,
+		Position: fn.position,
+	}
+	if fn.enclosing != nil {
+		enclosing := fn.enclosing.info()
+		info.Enclosing = &enclosing
+	}
+	return info
+}
+
+// declaredNames that can be in scope at start of body of function, which are names declared in file,
+// and names declared before body in declaration that function is in, eg parameters and locals of enclosing function.
+// Objects are resolved by parser, thus declarations in other files of package are not known.
+func (fn function) declaredNames() map[string]bool {
+	names := map[string]bool{}
+	for name := range fn.file.Scope.Objects {
+		names[name] = true
+	}
+	for _, decl := range fn.file.Decls {
+		if fn.pos < decl.Pos() || fn.pos >= decl.End() {
+			continue
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if q, ok := n.(*ast.Ident); ok && q.Obj != nil && q.Obj.Kind != ast.Lbl && q.Obj.Pos() < fn.body.Lbrace {
+				names[q.Obj.Name] = true
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// attribute is parameter or result that is recorded in span attributes.
+type attribute struct {
+	name  *ast.Ident
+	field *ast.Field
+}
+
+// attributes of function, which are parameters listed in `//instrument:attrs` directive and named results when returns is set.
+// Results with names given by nameResults are not recorded.
+func (fn function) attributes(returns bool) (params, results []attribute) {
+	if names, ok := attrsFromDoc(fn.doc); ok {
+		params = fieldAttributes(fn.fnType.Params, func(name string) bool { return len(names) == 0 || slices.Contains(names, name) })
+	}
+	if returns {
+		results = fieldAttributes(fn.fnType.Results, func(name string) bool { return !isResultName(name) })
+	}
+	return params, results
+}
+
+func fieldAttributes(fields *ast.FieldList, accept func(name string) bool) []attribute {
+	if fields == nil {
+		return nil
+	}
+
+	var attrs []attribute
+	for _, q := range fields.List {
+		for _, name := range q.Names {
+			if name.Name != "_" && accept(name.Name) {
+				attrs = append(attrs, attribute{name: name, field: q})
+			}
+		}
+	}
+	return attrs
+}
+
+// param with type in type-checked mode.
+func (q attribute) param(info *types.Info) instrument.Param {
+	param := instrument.Param{Name: q.name.Name, Type: q.field.Type}
+	if info != nil {
+		param.TypeInfo = info.TypeOf(q.field.Type)
+	}
+	return param
+}
+
+// instrumentParams of attributes.
+// Sensitive attributes are left out, or their values are hashed.
+func instrumentParams(attrs []attribute, info *types.Info, redact RedactPolicy) []instrument.Param {
+	var params []instrument.Param
+	for _, q := range attrs {
+		param := q.param(info)
+		if redact.sensitive(param) {
+			if !redact.Hash {
+				continue
+			}
+			param.Hash = true
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// usesParam when body references parameter with name.
+// References are resolved by types when they are set, or by parser otherwise.
+// Parameter is assumed to be used when it can not be resolved.
+func (fn function) usesParam(name string, info *types.Info) bool {
+	var param *ast.Ident
+	if fn.fnType.Params != nil {
+		for _, q := range fn.fnType.Params.List {
+			for _, ident := range q.Names {
+				if ident.Name == name {
+					param = ident
+				}
+			}
+		}
+	}
+	if param == nil || fn.body == nil {
+		return true
+	}
+
+	var obj types.Object
+	if info != nil && info.Defs != nil {
+		obj = info.Defs[param]
+	}
+	if obj == nil && param.Obj == nil {
+		return true
+	}
+
+	used := false
+	ast.Inspect(fn.body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+			if obj != nil {
+				used = used || info.Uses[ident] == obj
+			} else {
+				used = used || ident.Obj == param.Obj
+			}
+		}
+		return !used
+	})
+	return used
+}
+
+// assignsContext when context with span can be assigned to parameter with name.
+// This is so unless types are set and type of parameter has other methods than context.Context.
+func (fn function) assignsContext(name string, info *types.Info) bool {
+	if info == nil || fn.fnType.Params == nil {
+		return true
+	}
+	for _, q := range fn.fnType.Params.List {
+		for _, ident := range q.Names {
+			if ident.Name != name {
+				continue
+			}
+			if t := info.TypeOf(q.Type); t != nil {
+				return isContextAssignable(t)
+			}
+		}
+	}
+	return true
+}
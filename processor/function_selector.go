@@ -1,15 +1,143 @@
 package processor
 
+import (
+	"go/ast"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	patternRegexpPrefix = "re:"
+	patternGlobPrefix   = "glob:"
+)
+
+// FunctionInfo describes function for FunctionSelector.
+type FunctionInfo struct {
+	Package  string
+	Receiver string // type name of receiver, empty for functions
+	Pointer  bool   // receiver is pointer
+	Name     string // name of function, anonymous for literals
+	Literal  bool
+	Pos      token.Pos // position of name for declarations
+	Position token.Position
+
+	// Enclosing is declaration of function that literal is in, which is nil for literals outside of functions.
+	Enclosing *FunctionInfo
+}
+
+// IsExported when function and its receiver type are exported, or when literal is in such function.
+func (fn FunctionInfo) IsExported() bool {
+	if fn.Literal {
+		return fn.Enclosing != nil && fn.Enclosing.IsExported()
+	}
+	return ast.IsExported(fn.Name) && (fn.Receiver == "" || ast.IsExported(fn.Receiver))
+}
+
+// keys of function in order of precedence, which are *Receiver.Name for pointer receivers, Receiver.Name for methods and Name.
+func (fn FunctionInfo) keys() []string {
+	if fn.Receiver == "" {
+		return []string{fn.Name}
+	}
+	qualified := fn.Receiver + "." + fn.Name
+	if fn.Pointer {
+		return []string{"*" + qualified, qualified, fn.Name}
+	}
+	return []string{qualified, fn.Name}
+}
+
 // MapFunctionSelector makes decision basedd on map value or else default.
+// Methods are looked up by receiver-qualified names first, eg *Cat.Name or Cat.Name, then by bare name.
+// Functions that are not in map are matched by patterns of their qualified names, eg Cat.Name for method or Name for function.
+// Exclude patterns go first.
+// Functions skipped by commands in their doc comments are never selected.
+// Other functions are selected by last matching rule or else by default.
 type MapFunctionSelector struct {
 	AcceptFunctions map[string]bool
 	Default         bool
+	SkipFunctions   map[token.Pos]bool
+	Rules           []Rule
+
+	IncludePatterns []FunctionPattern
+	ExcludePatterns []FunctionPattern
 }
 
-func (s MapFunctionSelector) AcceptFunction(functionName string) bool {
-	v, ok := s.AcceptFunctions[functionName]
-	if ok {
-		return v
+func (s MapFunctionSelector) AcceptFunction(fn FunctionInfo) bool {
+	if s.SkipFunctions[fn.Pos] {
+		return false
+	}
+
+	for _, key := range fn.keys() {
+		if v, ok := s.AcceptFunctions[key]; ok {
+			return v
+		}
+	}
+
+	qualifiedName := BasicSpanName(fn.Receiver, fn.Name)
+	for _, q := range s.ExcludePatterns {
+		if q.MatchString(qualifiedName) {
+			return false
+		}
+	}
+	for _, q := range s.IncludePatterns {
+		if q.MatchString(qualifiedName) {
+			return true
+		}
+	}
+	for i := len(s.Rules) - 1; i >= 0; i-- {
+		if s.Rules[i].matchFunction(fn) {
+			return s.Rules[i].Include
+		}
 	}
 	return s.Default
 }
+
+// VisibilitySelector selects functions of Selector that have visibility, eg only public API of library.
+type VisibilitySelector struct {
+	Selector   FunctionSelector
+	Visibility Visibility
+}
+
+func (s VisibilitySelector) AcceptFunction(fn FunctionInfo) bool {
+	switch s.Visibility {
+	case VisibilityExported:
+		if !fn.IsExported() {
+			return false
+		}
+	case VisibilityUnexported:
+		if fn.IsExported() {
+			return false
+		}
+	}
+	return s.Selector.AcceptFunction(fn)
+}
+
+// FunctionPattern matches qualified name of function.
+type FunctionPattern interface {
+	MatchString(s string) bool
+}
+
+// globPattern in syntax of path.Match.
+type globPattern string
+
+func (g globPattern) MatchString(s string) bool {
+	ok, _ := path.Match(string(g), s)
+	return ok
+}
+
+// parseFunctionPattern with re: prefix for regular expression and glob: prefix for glob.
+// Other strings are not patterns.
+func parseFunctionPattern(s string) (FunctionPattern, bool, error) {
+	switch {
+	case strings.HasPrefix(s, patternRegexpPrefix):
+		re, err := regexp.Compile(s[len(patternRegexpPrefix):])
+		return re, true, err
+	case strings.HasPrefix(s, patternGlobPrefix):
+		g := s[len(patternGlobPrefix):]
+		_, err := path.Match(g, "")
+		return globPattern(g), true, err
+	default:
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,149 @@
+package processor_test
+
+import (
+	"go/parser"
+	"go/token"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+func TestMapFunctionSelector_Receiver(t *testing.T) {
+	commands := []processor.Command{}
+	for _, s := range []string{
+		"//instrument:exclude Name|*Apple.Eat",
+		"//instrument:include Cat.Name|Apple.Peel",
+	} {
+		c, err := processor.ParseCommand(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, c)
+	}
+	s := processor.NewMapFunctionSelectorFromCommands(true, commands)
+
+	tests := []struct {
+		fn     processor.FunctionInfo
+		accept bool
+	}{
+		{fn: processor.FunctionInfo{Receiver: "Cat", Name: "Name"}, accept: true},
+		{fn: processor.FunctionInfo{Receiver: "Cat", Pointer: true, Name: "Name"}, accept: true},
+		{fn: processor.FunctionInfo{Receiver: "Dog", Name: "Name"}, accept: false},
+		{fn: processor.FunctionInfo{Name: "Name"}, accept: false},
+		{fn: processor.FunctionInfo{Receiver: "Apple", Pointer: true, Name: "Eat"}, accept: false},
+		{fn: processor.FunctionInfo{Receiver: "Apple", Name: "Eat"}, accept: true},
+		{fn: processor.FunctionInfo{Receiver: "Apple", Pointer: true, Name: "Peel"}, accept: true},
+		{fn: processor.FunctionInfo{Name: "anonymous", Literal: true}, accept: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.fn.Receiver+"."+tc.fn.Name, func(t *testing.T) {
+			if accept := s.AcceptFunction(tc.fn); accept != tc.accept {
+				t.Errorf("expected %v, got %v", tc.accept, accept)
+			}
+		})
+	}
+
+	t.Run("generic", func(t *testing.T) {
+		src := `package example
+
+import "context"
+
+//instrument:exclude Box.Put|*Pair.Swap
+
+type Box[T any] struct{ v T }
+
+func (b *Box[T]) Put(ctx context.Context, v T) { b.v = v }
+
+func (b *Box[T]) Get(ctx context.Context) T { return b.v }
+
+type Pair[K comparable, V any] struct{}
+
+func (p *Pair[K, V]) Swap(ctx context.Context) {}
+
+func (p Pair[K, V]) Keys(ctx context.Context) {}
+`
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "example.go", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		findings, _, err := processor.NewTraceProcessor(processor.DefaultTracePattern).CheckFile(fset, file, nil, processor.DefaultTraceConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var spans []string
+		for _, q := range findings {
+			spans = append(spans, q.SpanName)
+		}
+		if exp := []string{"Box.Get", "Pair.Keys"}; !slices.Equal(spans, exp) {
+			t.Errorf("expected %v, got %v", exp, spans)
+		}
+	})
+}
+
+func TestMapFunctionSelector_Patterns(t *testing.T) {
+	commands := []processor.Command{}
+	for _, s := range []string{
+		"//instrument:exclude re:^Cache\\.(Get|Put)$|glob:*.Delete[A-Z|]*",
+		"//instrument:include re:^(Cache|Store)\\..*|Run",
+	} {
+		c, err := processor.ParseCommand(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, c)
+	}
+	s := processor.NewMapFunctionSelectorFromCommands(false, commands)
+
+	tests := []struct {
+		fn     processor.FunctionInfo
+		accept bool
+	}{
+		{fn: processor.FunctionInfo{Receiver: "Cache", Name: "Get"}, accept: false},
+		{fn: processor.FunctionInfo{Receiver: "Cache", Name: "Put"}, accept: false},
+		{fn: processor.FunctionInfo{Receiver: "Cache", Name: "DeleteAll"}, accept: false},
+		{fn: processor.FunctionInfo{Receiver: "Cache", Name: "Len"}, accept: true},
+		{fn: processor.FunctionInfo{Receiver: "Store", Name: "Get"}, accept: true},
+		{fn: processor.FunctionInfo{Name: "Run"}, accept: true},
+		{fn: processor.FunctionInfo{Name: "Get"}, accept: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.fn.Receiver+"."+tc.fn.Name, func(t *testing.T) {
+			if accept := s.AcceptFunction(tc.fn); accept != tc.accept {
+				t.Errorf("expected %v, got %v", tc.accept, accept)
+			}
+		})
+	}
+}
+
+func TestVisibilitySelector(t *testing.T) {
+	exported := processor.FunctionInfo{Receiver: "Client", Name: "Get"}
+	tests := []struct {
+		name     string
+		fn       processor.FunctionInfo
+		exported bool
+	}{
+		{name: "function", fn: processor.FunctionInfo{Name: "Get"}, exported: true},
+		{name: "unexported function", fn: processor.FunctionInfo{Name: "get"}, exported: false},
+		{name: "method", fn: exported, exported: true},
+		{name: "method of unexported type", fn: processor.FunctionInfo{Receiver: "client", Name: "Get"}, exported: false},
+		{name: "literal in exported function", fn: processor.FunctionInfo{Name: "anonymous", Literal: true, Enclosing: &exported}, exported: true},
+		{name: "literal outside of function", fn: processor.FunctionInfo{Name: "anonymous", Literal: true}, exported: false},
+	}
+	all := processor.MapFunctionSelector{Default: true}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if accept := (processor.VisibilitySelector{Selector: all, Visibility: processor.VisibilityExported}).AcceptFunction(tc.fn); accept != tc.exported {
+				t.Errorf("exported: expected %v, got %v", tc.exported, accept)
+			}
+			if accept := (processor.VisibilitySelector{Selector: all, Visibility: processor.VisibilityUnexported}).AcceptFunction(tc.fn); accept == tc.exported {
+				t.Errorf("unexported: expected %v, got %v", !tc.exported, accept)
+			}
+			if accept := (processor.VisibilitySelector{Selector: all, Visibility: processor.VisibilityAll}).AcceptFunction(tc.fn); !accept {
+				t.Error("all: expected accepted")
+			}
+		})
+	}
+}
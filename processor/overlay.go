@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// overlay collects instrumented copies of files in format of `go build -overlay`.
+type overlay struct {
+	mu      sync.Mutex
+	Replace map[string]string
+}
+
+// collectOverlay when overlay file is requested and copies are not collected by caller yet.
+// Returned function writes overlay file.
+func collectOverlay(conf *TraceConfig) func() error {
+	if conf.Overlay == "" || conf.overlay != nil {
+		return func() error { return nil }
+	}
+
+	o := &overlay{Replace: map[string]string{}}
+	conf.overlay = o
+
+	return func() error { return o.writeFile(conf.Overlay) }
+}
+
+func (o *overlay) add(fileName, copyName string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.Replace[fileName] = copyName
+}
+
+func (o *overlay) writeFile(fileName string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	b, err := json.MarshalIndent(o, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(b, '\n'), 0644)
+}
+
+// writeOverlayFile writes copy of file into overlay directory under its absolute path.
+// Files that are not changed are not added to overlay.
+func writeOverlayFile(fileName string, conf TraceConfig, src, res []byte) error {
+	if conf.OverlayDir == "" {
+		return errors.New("missing overlay directory")
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+
+	absName, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+
+	copyName := filepath.Join(conf.OverlayDir, absName[len(filepath.VolumeName(absName)):])
+	if err := os.MkdirAll(filepath.Dir(copyName), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(copyName, res, 0644); err != nil {
+		return err
+	}
+
+	conf.overlay.add(absName, copyName)
+	return nil
+}
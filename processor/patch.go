@@ -9,8 +9,10 @@ import (
 	"sort"
 )
 
+// patch inserts statements after pos, replacing statements up to end when it is valid.
 type patch struct {
 	pos   token.Pos
+	end   token.Pos
 	stmts []ast.Stmt
 }
 
@@ -34,12 +36,18 @@ func patchFile(fset *token.FileSet, file *ast.File, patches ...patch) error {
 		if err := format.Node(&buf, fset, patch.stmts); err != nil {
 			return err
 		}
-		buf.WriteString("\n")
 
 		pos := int(patch.pos) - offset
-		src = append(src[:pos], append(buf.Bytes(), src[pos:]...)...)
+		end := pos
+		if patch.end.IsValid() {
+			// replaced statements are followed by empty line already
+			end = int(patch.end) - offset - 1
+		} else {
+			buf.WriteString("\n")
+		}
+		src = append(src[:pos], append(buf.Bytes(), src[end:]...)...)
 		// patch positions after need to be shifted up relative to updates in src by buffer
-		offset -= buf.Len()
+		offset -= buf.Len() - (end - pos)
 	}
 
 	nfile, err := parser.ParseFile(fset, fset.Position(file.Pos()).Filename, src, parser.ParseComments)
@@ -1,6 +1,9 @@
 package processor
 
-import "go/ast"
+import (
+	"go/ast"
+	"go/types"
+)
 
 type TracePatternType int
 
@@ -11,10 +14,17 @@ const (
 
 type SpanFunc func(receiver, function string) string
 
+// Pattern tells if function matches pattern.
+// TracePattern takes function type, pattern type and optional types of file.
 type Pattern interface {
 	Match(args ...any) bool
 }
 
+// Finder is Pattern that finds names of matching parameters and results, with same arguments as Match.
+type Finder interface {
+	Find(args ...any) []string
+}
+
 var (
 	DefaultTracePattern *TracePattern = &TracePattern{
 		ContextName:    "ctx",
@@ -34,27 +44,39 @@ type TracePattern struct {
 }
 
 func (p *TracePattern) Match(args ...any) bool {
-	if len(args) == 0 {
-		return false
+	return len(p.Find(args...)) > 0
+}
+
+// Find names of parameters or results that match pattern.
+// Context named ContextName and error named ErrorName go first, others are in order of declaration.
+func (p *TracePattern) Find(args ...any) []string {
+	if len(args) < 2 {
+		return nil
 	}
 
 	fnType, ok := args[0].(*ast.FuncType)
 	if !ok {
-		return false
+		return nil
 	}
 
 	patternType, ok := args[1].(TracePatternType)
 	if !ok {
-		return false
+		return nil
+	}
+
+	// types of file in type-checked mode
+	var info *types.Info
+	if len(args) > 2 {
+		info, _ = args[2].(*types.Info)
 	}
 
 	switch patternType {
 	case TracePatternContext:
-		return functionHasContext(fnType, p.ContextName, p.ContextPackage, p.ContextType)
+		return preferred(functionContexts(fnType, p.ContextPackage, p.ContextType, info), p.ContextName)
 	case TracePatternError:
-		return functionHasError(fnType, p.ErrorName, p.ErrorType)
+		return preferred(functionErrors(fnType, p.ErrorType, info), p.ErrorName)
 	default:
-		return false
+		return nil
 	}
 }
 
@@ -81,6 +103,13 @@ func methodReceiverTypeName(fn *ast.FuncDecl) string {
 		if v, ok := v.Type.(*ast.StarExpr); ok {
 			t = v.X
 		}
+		// generic receiver
+		switch v := t.(type) {
+		case *ast.IndexExpr:
+			t = v.X
+		case *ast.IndexListExpr:
+			t = v.X
+		}
 		// value/pointer receiver
 		if v, ok := t.(*ast.Ident); ok {
 			return v.Name
@@ -89,6 +118,14 @@ func methodReceiverTypeName(fn *ast.FuncDecl) string {
 	return ""
 }
 
+func isPointerReceiver(fn *ast.FuncDecl) bool {
+	if fn == nil || fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return false
+	}
+	_, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+	return ok
+}
+
 func functionName(fn *ast.FuncDecl) string {
 	if fn == nil || fn.Name == nil {
 		return ""
@@ -96,21 +133,26 @@ func functionName(fn *ast.FuncDecl) string {
 	return fn.Name.Name
 }
 
-func isContext(e *ast.Field, contextName, contextPackage, contextType string) bool {
-	// anonymous arg
-	// multiple symbols
-	// strange symbol
-	if e == nil || len(e.Names) != 1 || e.Names[0] == nil {
-		return false
+// contextNames of parameters that can be used in inserted statements, when they have type of context.
+func contextNames(e *ast.Field, contextPackage, contextType string, info *types.Info) []string {
+	if e == nil || !isContext(e.Type, contextPackage, contextType, info) {
+		return nil
 	}
-	if e.Names[0].Name != contextName {
-		return false
+
+	return usableNames(e.Names)
+}
+
+func isContext(e ast.Expr, contextPackage, contextType string, info *types.Info) bool {
+	if info != nil {
+		if t := info.TypeOf(e); t != nil {
+			return isContextType(t)
+		}
 	}
 
 	pkg := ""
 	sym := ""
 
-	if se, ok := e.Type.(*ast.SelectorExpr); ok && se != nil {
+	if se, ok := e.(*ast.SelectorExpr); ok && se != nil {
 		if v, ok := se.X.(*ast.Ident); ok && v != nil {
 			pkg = v.Name
 		}
@@ -122,55 +164,69 @@ func isContext(e *ast.Field, contextName, contextPackage, contextType string) bo
 	return pkg == contextPackage && sym == contextType
 }
 
-func isError(e *ast.Field, errorName, errorType string) bool {
-	if e == nil {
-		return false
+// errorNames of results that can be used in inserted statements, when they have error type.
+func errorNames(e *ast.Field, errorType string, info *types.Info) []string {
+	if e == nil || !isError(e.Type, errorType, info) {
+		return nil
 	}
-	// anonymous arg
-	// multiple symbols
-	// strange symbol
-	if len(e.Names) != 1 || e.Names[0] == nil {
-		return false
-	}
-	if e.Names[0].Name != errorName {
-		return false
+	return usableNames(e.Names)
+}
+
+func isError(e ast.Expr, errorType string, info *types.Info) bool {
+	if info != nil {
+		if t := info.TypeOf(e); t != nil {
+			return types.Identical(t, types.Universe.Lookup("error").Type())
+		}
 	}
 
-	if v, ok := e.Type.(*ast.Ident); ok && v != nil {
+	if v, ok := e.(*ast.Ident); ok && v != nil {
 		return v.Name == errorType
 	}
 
 	return false
 }
 
-func functionHasContext(fnType *ast.FuncType, contextName, contextPackage, contextType string) bool {
-	if fnType == nil {
-		return false
+// usableNames skips blank names, since they can not be referenced.
+func usableNames(idents []*ast.Ident) []string {
+	var names []string
+	for _, q := range idents {
+		if q != nil && q.Name != "_" {
+			names = append(names, q.Name)
+		}
 	}
+	return names
+}
 
-	if ps := fnType.Params; ps != nil {
-		for _, q := range ps.List {
-			if isContext(q, contextName, contextPackage, contextType) {
-				return true
-			}
+// preferred name goes first.
+func preferred(names []string, name string) []string {
+	for i, q := range names {
+		if q == name {
+			return append([]string{q}, append(names[:i:i], names[i+1:]...)...)
 		}
 	}
-
-	return false
+	return names
 }
 
-func functionHasError(fnType *ast.FuncType, errorName, errorType string) bool {
-	if fnType == nil {
-		return false
+func functionContexts(fnType *ast.FuncType, contextPackage, contextType string, info *types.Info) []string {
+	if fnType == nil || fnType.Params == nil {
+		return nil
 	}
 
-	if rs := fnType.Results; rs != nil {
-		for _, q := range rs.List {
-			if isError(q, errorName, errorType) {
-				return true
-			}
-		}
+	var names []string
+	for _, q := range fnType.Params.List {
+		names = append(names, contextNames(q, contextPackage, contextType, info)...)
 	}
+	return names
+}
 
-	return false
+func functionErrors(fnType *ast.FuncType, errorType string, info *types.Info) []string {
+	if fnType == nil || fnType.Results == nil {
+		return nil
+	}
+
+	var names []string
+	for _, q := range fnType.Results.List {
+		names = append(names, errorNames(q, errorType, info)...)
+	}
+	return names
 }
@@ -1,7 +1,9 @@
 package processor
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
@@ -9,6 +11,11 @@ import (
 	"go/types"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
 
 	"github.com/nikolaydubina/go-instrument/instrument"
 	"golang.org/x/sync/errgroup"
@@ -18,6 +25,7 @@ import (
 var (
 	// for testing purpose
 	defaultOut io.Writer = os.Stdout
+	outMu      sync.Mutex
 )
 
 var (
@@ -25,14 +33,11 @@ var (
 )
 
 // Instrumenter supplies ast of Go code that will be inserted and required dependencies.
-type Instrumenter interface {
-	Imports() []*types.Package
-	PrefixStatements(spanName string, hasError bool) []ast.Stmt
-}
+type Instrumenter = instrument.Instrumenter
 
 // FunctionSelector tells if function has to be instrumented.
 type FunctionSelector interface {
-	AcceptFunction(functionName string) bool
+	AcceptFunction(fn FunctionInfo) bool
 }
 
 type Processor interface {
@@ -40,9 +45,10 @@ type Processor interface {
 }
 
 type Task struct {
-	FileName string
-	Config   TraceConfig
-	ErrCh    chan error
+	FileName        string
+	Config          TraceConfig
+	NewInstrumenter instrument.Factory
+	ErrCh           chan error
 }
 
 func NewTraceProcessor(pattern Pattern) *TraceProcessor {
@@ -54,10 +60,18 @@ func NewTraceProcessor(pattern Pattern) *TraceProcessor {
 
 // TraceProcessor traverses AST, collects details on functions and methods, and invokes Instrumenter
 type TraceProcessor struct {
-	Instrumenter     Instrumenter
+	// NewInstrumenter makes Instrumenter for each function when it is set.
+	// Otherwise, Instrumenter is made from instrument registry by TraceConfig.Instrumenter.
+	NewInstrumenter  instrument.Factory
 	FunctionSelector FunctionSelector
 	SpanName         SpanFunc
 	Pattern          Pattern
+
+	// PanicSelector tells if panics are recorded in span of function, which they are not when it is nil.
+	PanicSelector FunctionSelector
+
+	// SpanNames by position of names of functions are used instead of SpanName.
+	SpanNames map[token.Pos]string
 }
 
 func (p *TraceProcessor) Process(fileName string, config ...any) error {
@@ -73,116 +87,435 @@ func (p *TraceProcessor) Process(fileName string, config ...any) error {
 		}
 	}
 
+	writeOverlay := collectOverlay(&conf)
+	collectPackages(&conf)
+
+	fset, file, err := parseFile(fileName, conf)
+	if err != nil || file == nil {
+		return err
+	}
+
+	info, err := typesInfo(fileName, file, conf)
+	if err != nil {
+		return err
+	}
+
+	if err := p.selectFunctions(fileName, file, conf); err != nil {
+		return err
+	}
+
+	newInstrumenter, err := p.instrumenter(conf)
+	if err != nil {
+		return err
+	}
+
+	if conf.NameResults {
+		if err := p.nameResults(fset, file, info, newInstrumenter, conf); err != nil {
+			return err
+		}
+		// file is parsed again with names, which moves positions of functions that commands are bound to
+		if info, err = typesInfo(fileName, file, conf); err != nil {
+			return err
+		}
+		if err := p.selectFunctions(fileName, file, conf); err != nil {
+			return err
+		}
+	}
+
+	if err := p.process(fset, file, info, newInstrumenter, conf); err != nil {
+		return err
+	}
+
+	if err := writeFile(fileName, conf, fset, file); err != nil {
+		return err
+	}
+
+	return writeOverlay()
+}
+
+// parseFile that is formatted first. File is nil when it has to be skipped.
+func parseFile(fileName string, conf TraceConfig) (*token.FileSet, *ast.File, error) {
 	if fileName == "" {
-		return errors.New("missing arg: file name")
+		return nil, nil, errors.New("missing arg: file name")
 	}
 
 	src, err := os.ReadFile(fileName)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	formattedSrc, err := format.Source(src)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
+	return parseSource(fileName, formattedSrc, conf)
+}
+
+// parseSource of file. File is nil when it has to be skipped.
+func parseSource(fileName string, src []byte, conf TraceConfig) (*token.FileSet, *ast.File, error) {
 	fset := token.NewFileSet()
 
-	file, err := parser.ParseFile(fset, fileName, formattedSrc, parser.ParseComments)
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	if conf.SkipGenerated && ast.IsGenerated(file) {
-		return errors.New("skipping generated file")
+		return nil, nil, errors.New("skipping generated file")
 	}
 
 	directives := GoBuildDirectivesFromFile(*file)
 	for _, q := range directives {
 		if q.SkipFile() {
-			return nil
+			return nil, nil, nil
+		}
+	}
+
+	return fset, file, nil
+}
+
+func writeFile(fileName string, conf TraceConfig, fset *token.FileSet, file *ast.File) error {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return err
+	}
+	res := buf.Bytes()
+
+	var src []byte
+	if conf.Overlay != "" || conf.List || conf.Diff {
+		var err error
+		if src, err = os.ReadFile(fileName); err != nil {
+			return err
+		}
+	}
+
+	if (conf.List || conf.Diff) && !bytes.Equal(src, res) {
+		var out bytes.Buffer
+		if conf.List {
+			fmt.Fprintln(&out, fileName)
+		}
+		if conf.Diff {
+			name := filepath.ToSlash(fileName)
+			out.Write(diff(name+".orig", src, name, res))
+		}
+		if err := writeOut(out.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case conf.Overlay != "":
+		return writeOverlayFile(fileName, conf, src, res)
+	case conf.Overwrite:
+		outf, err := os.OpenFile(fileName, os.O_RDWR|os.O_TRUNC, 0)
+		if err != nil {
+			return err
 		}
+		defer outf.Close()
+		_, err = outf.Write(res)
+		return err
+	case conf.List || conf.Diff:
+		return nil
+	default:
+		return writeOut(res)
 	}
+}
+
+// writeOut at once, so that output of files processed in parallel is not mixed.
+func writeOut(b []byte) error {
+	outMu.Lock()
+	defer outMu.Unlock()
+	_, err := defaultOut.Write(b)
+	return err
+}
 
+// selectFunctions of file by rules of project and commands in file.
+func (p *TraceProcessor) selectFunctions(fileName string, file *ast.File, conf TraceConfig) error {
 	commands, err := CommandsFromFile(*file)
 	if err != nil {
 		return err
 	}
 
-	p.FunctionSelector = NewMapFunctionSelectorFromCommands(conf.DefaultSelect, commands)
+	rules, err := conf.Rules.forFile(conf.sourceName(fileName))
+	if err != nil {
+		return err
+	}
+
+	selector := NewMapFunctionSelectorFromCommands(conf.DefaultSelect, commands)
+	selector.Rules = rules
+	p.FunctionSelector = VisibilitySelector{Selector: selector, Visibility: conf.Visibility}
+	p.PanicSelector = NewPanicFunctionSelectorFromCommands(conf.RecordPanic, commands)
+	p.SpanNames = SpanNamesFromCommands(commands)
+	return nil
+}
+
+// spanName of function that is set by command in its doc comment or else by SpanName.
+func (p *TraceProcessor) spanName(fn function) string {
+	if name, ok := p.SpanNames[fn.pos]; ok {
+		return name
+	}
+	return p.SpanName(fn.receiver, fn.name)
+}
 
-	p.Instrumenter = &instrument.OpenTelemetry{
-		TracerName:  conf.App,
-		ContextName: "ctx",
-		ErrorName:   "err",
+// instrumenter makes Instrumenters for file by factory supplied by caller or else by factory from registry.
+// Instrumenters keep state of statements they made, thus new one is made for each function.
+func (p *TraceProcessor) instrumenter(conf TraceConfig) (func() Instrumenter, error) {
+	factory := p.NewInstrumenter
+	if factory == nil {
+		var err error
+		if factory, err = instrument.Lookup(conf.Instrumenter); err != nil {
+			return nil, err
+		}
 	}
+	instrumentConfig := conf.instrumentConfig()
+	return func() Instrumenter { return factory(instrumentConfig) }, nil
+}
 
-	if err := p.process(fset, file); err != nil {
+func (p *TraceProcessor) process(fset *token.FileSet, file *ast.File, info *types.Info, newInstrumenter func() Instrumenter, conf TraceConfig) error {
+	fns, err := p.uninstrumented(fset, file, info, newInstrumenter, conf)
+	if err != nil {
 		return err
 	}
 
-	var out io.Writer = defaultOut
-	if conf.Overwrite {
-		outf, err := os.OpenFile(fileName, os.O_RDWR|os.O_TRUNC, 0)
+	var patches []patch
+	for _, q := range fns {
+		patches = append(patches, patch{pos: q.fn.body.Pos(), end: q.end, stmts: q.stmts})
+	}
+
+	if len(patches) > 0 {
+		var imports []*types.Package
+		for _, q := range fns {
+			imports = append(imports, q.imports...)
+		}
+		missing, err := missingImports(fset, file, conf.sourceName(fset.Position(file.Pos()).Filename), imports)
 		if err != nil {
 			return err
 		}
-		defer outf.Close()
-		out = outf
+
+		if err := patchFile(fset, file, patches...); err != nil {
+			return err
+		}
+		for _, pkg := range missing {
+			astutil.AddNamedImport(fset, file, importName(pkg), pkg.Path())
+		}
 	}
 
-	return format.Node(out, fset, file)
+	return nil
 }
 
-func (p *TraceProcessor) process(fset *token.FileSet, file *ast.File) error {
-	var patches []patch
+// missingImports are packages that file does not import by same name.
+// Package without name is referenced by last element of its path, and imports of file without names by name guessed from path.
+// Packages are not imported when name is used by other import of file, or when they are package of file itself, which is package of source file.
+func missingImports(fset *token.FileSet, file *ast.File, sourceName string, pkgs []*types.Package) ([]*types.Package, error) {
+	var pkgPath *string
+	var missing []*types.Package
+	for _, pkg := range pkgs {
+		name := packageName(pkg)
+		if i := slices.IndexFunc(missing, func(v *types.Package) bool { return packageName(v) == name }); i >= 0 {
+			if missing[i].Path() != pkg.Path() {
+				return nil, fmt.Errorf("%s: import %q as %s: name is used by import %q", fset.Position(file.Pos()).Filename, pkg.Path(), name, missing[i].Path())
+			}
+			continue
+		}
+
+		imported := false
+		for _, q := range file.Imports {
+			importPath, err := strconv.Unquote(q.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			importName := instrument.PackageName(importPath)
+			if q.Name != nil {
+				importName = q.Name.Name
+			}
+			if importName != name {
+				continue
+			}
+			if importPath != pkg.Path() {
+				return nil, fmt.Errorf("%s: import %q as %s: name is used by import %q", fset.Position(file.Pos()).Filename, pkg.Path(), name, importPath)
+			}
+			imported = true
+		}
+		if imported {
+			continue
+		}
+
+		if pkgPath == nil {
+			dir, err := filepath.Abs(filepath.Dir(sourceName))
+			if err != nil {
+				return nil, err
+			}
+			s, err := packagePath(dir)
+			if err != nil {
+				return nil, err
+			}
+			pkgPath = &s
+		}
+		if pkg.Path() == *pkgPath {
+			return nil, fmt.Errorf("%s: import %q: package can not import itself", fset.Position(file.Pos()).Filename, pkg.Path())
+		}
+
+		missing = append(missing, pkg)
+	}
+	return missing, nil
+}
+
+// packageName by which package is referenced in inserted statements.
+func packageName(pkg *types.Package) string {
+	if pkg.Name() == "" {
+		return path.Base(pkg.Path())
+	}
+	return pkg.Name()
+}
+
+// importName of package in import spec, which is empty when it is last element of path.
+func importName(pkg *types.Package) string {
+	if name := packageName(pkg); name != path.Base(pkg.Path()) {
+		return name
+	}
+	return ""
+}
 
-	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
-		if c == nil {
-			return true
+// packageNames of errors and packages of matchers, that can not be referenced by names by PackageName in function,
+// since these names are declared in function or in file, or are used by imports of other packages.
+// These packages are imported by names with underscores appended.
+func packageNames(fn function, matchers []instrument.ErrorMatcher) map[string]string {
+	if len(matchers) == 0 || fn.file == nil {
+		return nil
+	}
+
+	used := map[string]string{}
+	for _, q := range fn.file.Imports {
+		importPath, err := strconv.Unquote(q.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := instrument.PackageName(importPath)
+		if q.Name != nil {
+			name = q.Name.Name
 		}
+		used[name] = importPath
+	}
+	for name := range fn.declaredNames() {
+		used[name] = ""
+	}
 
-		var receiver, fname string
-		var fnType *ast.FuncType
-		var fnBody *ast.BlockStmt
+	paths := []string{"errors"}
+	for _, q := range matchers {
+		paths = append(paths, q.Path)
+	}
 
-		switch fn := c.Node().(type) {
-		case *ast.FuncLit:
-			fnType, fnBody = fn.Type, fn.Body
-			fname = "anonymous"
-		case *ast.FuncDecl:
-			fnType, fnBody = fn.Type, fn.Body
-			fname = functionName(fn)
-			receiver = methodReceiverTypeName(fn)
-		default:
-			return true
+	var names map[string]string
+	for _, importPath := range paths {
+		name := instrument.PackageName(importPath)
+		alias := name
+		for q, ok := used[alias]; ok && q != importPath; q, ok = used[alias] {
+			alias += "_"
+		}
+		used[alias] = importPath
+		if alias != name {
+			if names == nil {
+				names = map[string]string{}
+			}
+			names[importPath] = alias
 		}
+	}
+	return names
+}
 
-		if !p.FunctionSelector.AcceptFunction(fname) {
-			return true
+// instrumentFunction is details of function for Instrumenter.
+// Context is named ctx and error is named err, when Pattern can not find their names.
+// Parameters and results are set when they are recorded in span attributes.
+func (p *TraceProcessor) instrumentFunction(fn function, info *types.Info, conf TraceConfig) instrument.Function {
+	params, results := fn.attributes(conf.ReturnAttributes)
+	recordPanic := p.PanicSelector != nil && p.PanicSelector.AcceptFunction(fn.info())
+
+	f, ok := p.Pattern.(Finder)
+	if !ok {
+		var errors []string
+		if p.Pattern.Match(fn.fnType, TracePatternError, info) {
+			errors = []string{"err"}
 		}
+		return instrument.Function{SpanName: p.spanName(fn), Context: "ctx", Errors: errors, Params: instrumentParams(params, info, conf.Redact), Results: instrumentParams(results, info, conf.Redact), RecordPanic: recordPanic, PackageNames: packageNames(fn, conf.IgnoreErrors)}
+	}
+
+	var contextName string
+	if names := f.Find(fn.fnType, TracePatternContext, info); len(names) > 0 {
+		contextName = names[0]
+	}
 
-		if p.Pattern.Match(fnType, TracePatternContext) {
-			ps := p.Instrumenter.PrefixStatements(
-				p.SpanName(receiver, fname),
-				p.Pattern.Match(fnType, TracePatternError),
-			)
-			patches = append(patches, patch{pos: fnBody.Pos(), stmts: ps})
+	return instrument.Function{
+		SpanName: p.spanName(fn),
+		Context:  contextName,
+		Errors:   f.Find(fn.fnType, TracePatternError, info),
+		Params:   instrumentParams(params, info, conf.Redact),
+		Results:  instrumentParams(results, info, conf.Redact),
+
+		RecordPanic:  recordPanic,
+		PackageNames: packageNames(fn, conf.IgnoreErrors),
+	}
+}
+
+// uninstrumentedFunction is function with statements that Instrumenter would insert and their imports.
+type uninstrumentedFunction struct {
+	fn      function
+	stmts   []ast.Stmt
+	imports []*types.Package
+
+	// end of stale statements inserted before, which are replaced, when it is valid.
+	end token.Pos
+}
+
+// uninstrumented functions that are selected and match pattern.
+// Functions with statements inserted before that differ from ones that would be inserted now, eg by span name, are uninstrumented too.
+func (p *TraceProcessor) uninstrumented(fset *token.FileSet, file *ast.File, info *types.Info, newInstrumenter func() Instrumenter, conf TraceConfig) ([]uninstrumentedFunction, error) {
+	var fns []uninstrumentedFunction
+
+	for _, fn := range p.selected(fset, file, info) {
+		f := p.instrumentFunction(fn, info, conf)
+		prev, err := matchInserted(fset, fn.body, f, newInstrumenter)
+		if err != nil {
+			return nil, err
+		}
+		if prev.n > 0 && (!prev.stale || !conf.UpdateSpans) {
+			continue
+		}
+		if d, ok := newInstrumenter().(instrument.Detector); ok && prev.n == 0 && conf.SkipManual && d.Instrumented(fn.body) {
+			continue
 		}
 
-		return true
-	})
+		rest := fn
+		if prev.stale {
+			// context is used by stale statements, which are replaced
+			rest.body = &ast.BlockStmt{List: fn.body.List[prev.n:]}
+		}
+		f.UnusedContext = !rest.usesParam(f.Context, info) || !fn.assignsContext(f.Context, info)
 
-	if len(patches) > 0 {
-		if err := patchFile(fset, file, patches...); err != nil {
-			return err
+		instrumenter := newInstrumenter()
+		stmts, err := instrumenter.PrefixStatements(f)
+		if err != nil {
+			return nil, err
 		}
-		for _, pkg := range p.Instrumenter.Imports() {
-			astutil.AddNamedImport(fset, file, pkg.Name(), pkg.Path())
+
+		q := uninstrumentedFunction{fn: fn, stmts: stmts, imports: instrumenter.Imports()}
+		if prev.stale {
+			q.end = fn.body.List[prev.n-1].End()
 		}
+		fns = append(fns, q)
 	}
 
-	return nil
+	return fns, nil
+}
+
+// selected functions that match pattern, whether they are instrumented or not.
+func (p *TraceProcessor) selected(fset *token.FileSet, file *ast.File, info *types.Info) []function {
+	var fns []function
+	for _, fn := range functionsFromFile(fset, file) {
+		if p.FunctionSelector.AcceptFunction(fn.info()) && p.Pattern.Match(fn.fnType, TracePatternContext, info) {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
 }
 
 func NewSerialTraceProcessor(pattern Pattern) *SerialTraceProcessor {
@@ -193,6 +526,9 @@ func NewSerialTraceProcessor(pattern Pattern) *SerialTraceProcessor {
 
 type SerialTraceProcessor struct {
 	Pattern Pattern
+
+	// NewInstrumenter makes Instrumenters for functions, see TraceProcessor.
+	NewInstrumenter instrument.Factory
 }
 
 func (p *SerialTraceProcessor) Process(fileNames []string, config ...any) error {
@@ -208,14 +544,18 @@ func (p *SerialTraceProcessor) Process(fileNames []string, config ...any) error
 		}
 	}
 
+	writeOverlay := collectOverlay(&conf)
+	collectPackages(&conf)
+
 	fp := NewTraceProcessor(p.Pattern)
+	fp.NewInstrumenter = p.NewInstrumenter
 	for _, fileName := range fileNames {
 		err := fp.Process(fileName, conf)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return writeOverlay()
 }
 
 func NewParallelTraceProcessor(worker int, pattern Pattern) *ParallelTraceProcessor {
@@ -228,6 +568,7 @@ func NewParallelTraceProcessor(worker int, pattern Pattern) *ParallelTraceProces
 			for {
 				select {
 				case task := <-taskCh:
+					p.NewInstrumenter = task.NewInstrumenter
 					task.ErrCh <- p.Process(task.FileName, task.Config)
 				case <-doneCh:
 					return
@@ -248,6 +589,9 @@ type ParallelTraceProcessor struct {
 	Pattern Pattern
 	TaskCh  chan Task
 	DoneCh  chan bool
+
+	// NewInstrumenter makes Instrumenters for functions, see TraceProcessor.
+	NewInstrumenter instrument.Factory
 }
 
 func (p *ParallelTraceProcessor) Process(fileNames []string, config ...any) error {
@@ -263,6 +607,9 @@ func (p *ParallelTraceProcessor) Process(fileNames []string, config ...any) erro
 		}
 	}
 
+	writeOverlay := collectOverlay(&conf)
+	collectPackages(&conf)
+
 	run := func() error {
 		var g errgroup.Group
 
@@ -270,9 +617,10 @@ func (p *ParallelTraceProcessor) Process(fileNames []string, config ...any) erro
 			g.Go(func() error {
 				errCh := make(chan error)
 				task := Task{
-					FileName: fileName,
-					Config:   conf,
-					ErrCh:    errCh,
+					FileName:        fileName,
+					Config:          conf,
+					NewInstrumenter: p.NewInstrumenter,
+					ErrCh:           errCh,
 				}
 
 				p.TaskCh <- task
@@ -285,5 +633,9 @@ func (p *ParallelTraceProcessor) Process(fileNames []string, config ...any) erro
 		return nil
 	}
 
-	return run()
+	if err := run(); err != nil {
+		return err
+	}
+
+	return writeOverlay()
 }
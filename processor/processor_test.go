@@ -1,13 +1,23 @@
 package processor
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
 )
 
 const (
@@ -16,6 +26,227 @@ const (
 	BenchParallelWorker = 16
 )
 
+type callInstrumenter struct{}
+
+func (s callInstrumenter) Imports() []*types.Package {
+	return []*types.Package{types.NewPackage("example.com/trace", "")}
+}
+
+func (s callInstrumenter) PrefixStatements(fn instrument.Function) ([]ast.Stmt, error) {
+	return []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "trace"}, Sel: &ast.Ident{Name: "Span"}},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"` + fn.SpanName + `"`}},
+	}}}, nil
+}
+
+// spanInstrumenter records span names of functions it made statements for.
+type spanInstrumenter struct {
+	callInstrumenter
+	spans map[string]bool
+}
+
+func (s *spanInstrumenter) PrefixStatements(fn instrument.Function) ([]ast.Stmt, error) {
+	if s.spans == nil {
+		s.spans = map[string]bool{}
+	}
+	s.spans[fn.SpanName] = true
+	return s.callInstrumenter.PrefixStatements(fn)
+}
+
+func TestTraceProcessor_Instrumenter(t *testing.T) {
+	var out bytes.Buffer
+	defaultOut = &out
+	defer func() {
+		defaultOut = os.Stdout
+	}()
+
+	p := NewTraceProcessor(DefaultTracePattern)
+	p.NewInstrumenter = func(conf instrument.Config) Instrumenter { return callInstrumenter{} }
+	if err := p.Process("../internal/testdata/basic.go", DefaultTraceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{`"example.com/trace"`, `trace.Span("Cat.Name")`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %s in output", s)
+		}
+	}
+	if strings.Contains(out.String(), "otel") {
+		t.Error("instrumenter is overwritten")
+	}
+}
+
+func TestParallelTraceProcessor_Instrumenter(t *testing.T) {
+	var out bytes.Buffer
+	defaultOut = &out
+	defer func() {
+		defaultOut = os.Stdout
+	}()
+
+	fileNames := []string{"../internal/testdata/basic.go", "../internal/testdata/panic.go", "../internal/testdata/directives.go"}
+
+	var mu sync.Mutex
+	var instrumenters []*spanInstrumenter
+	p := NewParallelTraceProcessor(2, DefaultTracePattern)
+	p.NewInstrumenter = func(conf instrument.Config) Instrumenter {
+		mu.Lock()
+		defer mu.Unlock()
+		q := &spanInstrumenter{}
+		instrumenters = append(instrumenters, q)
+		return q
+	}
+	if err := p.Process(fileNames, DefaultTraceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instrumenters) == 0 {
+		t.Error("expected instrumenters")
+	}
+	for _, q := range instrumenters {
+		if len(q.spans) > 1 {
+			t.Errorf("instrumenter is shared by functions: %v", q.spans)
+		}
+	}
+	if !strings.Contains(out.String(), `trace.Span("checkout.pay")`) || strings.Contains(out.String(), "otel") {
+		t.Errorf("instrumenter is not used: %s", out.String())
+	}
+}
+
+func TestTraceProcessor_UnknownInstrumenter(t *testing.T) {
+	defaultOut = io.Discard
+	defer func() {
+		defaultOut = os.Stdout
+	}()
+
+	conf := DefaultTraceConfig
+	conf.Instrumenter = "asdf"
+
+	p := NewTraceProcessor(DefaultTracePattern)
+	if err := p.Process("../internal/testdata/basic.go", conf); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestTraceProcessor_Check(t *testing.T) {
+	p := NewTraceProcessor(DefaultTracePattern)
+
+	findings, redactions, err := p.Check("../internal/testdata/basic.go", DefaultTraceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 21 {
+		t.Errorf("expected 21 findings, got %d", len(findings))
+	}
+	if s := findings[2].String(); s != "../internal/testdata/basic.go:27:14: Cat.Name missing span" {
+		t.Errorf("wrong finding: %s", s)
+	}
+	if len(findings[0].Edits) != 3 || !strings.Contains(string(findings[0].Edits[1].NewText), `"go.opentelemetry.io/otel/codes"`) {
+		t.Errorf("expected imports of statements in finding: %v", findings[0].Edits)
+	}
+	for _, q := range findings {
+		if len(q.Edits) < 2 || string(q.Edits[0].NewText) != "\n\t\"go.opentelemetry.io/otel\"" {
+			t.Errorf("expected import in each finding: %v", q.Edits)
+		}
+	}
+
+	if len(redactions) != 0 {
+		t.Errorf("expected no redactions, got %v", redactions)
+	}
+
+	findings, _, err = p.Check("../internal/testdata/instrumented/basic.go.exp", DefaultTraceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+}
+
+func TestMissingImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		imports string
+		pkg     *types.Package
+		exp     int
+		err     bool
+	}{
+		{name: "missing", pkg: types.NewPackage("github.com/jackc/pgx/v5", "pgx"), exp: 1},
+		{name: "imported", imports: `"io"`, pkg: types.NewPackage("io", "io")},
+		{name: "imported by other name", imports: `db "github.com/jackc/pgx/v5"`, pkg: types.NewPackage("github.com/jackc/pgx/v5", "pgx"), exp: 1},
+		{name: "name of other import", imports: `errors "github.com/pkg/errors"`, pkg: types.NewPackage("errors", ""), err: true},
+		{name: "guessed name of other import", imports: `"github.com/pkg/errors"`, pkg: types.NewPackage("errors", ""), err: true},
+		{name: "package of file", pkg: types.NewPackage("example.com/app", "app"), err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := "package app\n"
+			if tc.imports != "" {
+				src += "import " + tc.imports + "\n"
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, filepath.Join(dir, "app.go"), src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			missing, err := missingImports(fset, file, filepath.Join(dir, "app.go"), []*types.Package{tc.pkg, tc.pkg})
+			if tc.err {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(missing) != tc.exp {
+				t.Errorf("expected %d missing, got %v", tc.exp, missing)
+			}
+		})
+	}
+}
+
+func TestParallelTraceProcessor_Overlay(t *testing.T) {
+	dir := t.TempDir()
+	src, _ := os.ReadFile("../internal/testdata/basic.go")
+	basic := filepath.Join(dir, "basic.go")
+	os.WriteFile(basic, src, 0644)
+	skipped, _ := filepath.Abs("../internal/testdata/skipped_gobuildignore.go")
+
+	conf := DefaultTraceConfig
+	conf.Overlay = filepath.Join(dir, "overlay.json")
+	conf.OverlayDir = filepath.Join(dir, "cache")
+
+	p := NewParallelTraceProcessor(2, DefaultTracePattern)
+	if err := p.Process([]string{basic, skipped}, conf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct{ Replace map[string]string }
+	b, _ := os.ReadFile(conf.Overlay)
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	copyName := filepath.Join(conf.OverlayDir, basic)
+	if len(got.Replace) != 1 || got.Replace[basic] != copyName {
+		t.Errorf("unexpected overlay: %v", got.Replace)
+	}
+
+	exp, _ := os.ReadFile("../internal/testdata/instrumented/basic.go.exp")
+	instrumented, _ := os.ReadFile(copyName)
+	if string(exp) != string(instrumented) {
+		t.Errorf("wrong instrumented copy: %s", instrumented)
+	}
+	if orig, _ := os.ReadFile(basic); string(orig) != string(src) {
+		t.Error("original file is changed")
+	}
+}
+
 func BenchmarkTraceProcessor(b *testing.B) {
 	tempDir := setupFiles(b, BenchSerailCount)
 
@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"slices"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+// RedactPolicy tells which parameters and results are sensitive, so that their values are not recorded in span attributes.
+type RedactPolicy struct {
+	// Names of sensitive parameters.
+	Names []*regexp.Regexp
+
+	// Types of sensitive parameters, as they are written in source (eg auth.Token) or with package path (eg example.com/auth.Token).
+	Types []string
+
+	// Hash values of sensitive parameters, instead of leaving them out.
+	// Hashes are not salted, so values that are few or can be guessed are revealed by them, and leaving values out is safe default.
+	Hash bool
+}
+
+// sensitive when name or type of parameter matches policy.
+// In type-checked mode, structs with fields that have `instrument:"redact"` tag are sensitive too.
+func (r RedactPolicy) sensitive(param instrument.Param) bool {
+	for _, q := range r.Names {
+		if q.MatchString(param.Name) {
+			return true
+		}
+	}
+
+	if slices.Contains(r.Types, types.ExprString(param.Type)) {
+		return true
+	}
+
+	if param.TypeInfo == nil {
+		return false
+	}
+	if slices.Contains(r.Types, param.TypeInfo.String()) {
+		return true
+	}
+	return hasRedactTag(param.TypeInfo)
+}
+
+// hasRedactTag when type is struct or pointer to struct, which has field with `instrument:"redact"` tag.
+func hasRedactTag(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		if reflect.StructTag(s.Tag(i)).Get("instrument") == "redact" {
+			return true
+		}
+	}
+	return false
+}
+
+// Redaction is parameter or result that is sensitive, so that it is left out of span attributes or its value is hashed.
+type Redaction struct {
+	Pos      token.Pos
+	Position token.Position
+	SpanName string
+	Name     string
+	Hash     bool
+}
+
+func (r Redaction) String() string { return fmt.Sprintf("%s: %s", r.Position, r.Message()) }
+
+// Message is redaction without position.
+func (r Redaction) Message() string {
+	action := "skipped"
+	if r.Hash {
+		action = "hashed"
+	}
+	return fmt.Sprintf("%s %s is %s", r.SpanName, r.Name, action)
+}
+
+// redactions of parameters and results of functions that would be recorded in span attributes.
+// Functions are reported whether they are instrumented or not.
+func (p *TraceProcessor) redactions(fset *token.FileSet, fns []function, info *types.Info, conf TraceConfig) []Redaction {
+	var redactions []Redaction
+	for _, fn := range fns {
+		params, results := fn.attributes(conf.ReturnAttributes)
+		for _, q := range append(params, results...) {
+			if !conf.Redact.sensitive(q.param(info)) {
+				continue
+			}
+			redactions = append(redactions, Redaction{
+				Pos:      q.name.Pos(),
+				Position: fset.Position(q.name.Pos()),
+				SpanName: p.spanName(fn),
+				Name:     q.name.Name,
+				Hash:     conf.Redact.Hash,
+			})
+		}
+	}
+	return redactions
+}
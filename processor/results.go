@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// nameResults of functions that would be instrumented and have unnamed error results, so that errors can be recorded.
+// First error is named err when it does not conflict with other names, other results are named _r<index>.
+func (p *TraceProcessor) nameResults(fset *token.FileSet, file *ast.File, info *types.Info, newInstrumenter func() Instrumenter, conf TraceConfig) error {
+	fns, err := p.uninstrumented(fset, file, info, newInstrumenter, conf)
+	if err != nil {
+		return err
+	}
+
+	var edits []edit
+	for _, q := range fns {
+		edits = append(edits, p.resultNameEdits(q.fn, info, int(file.FileStart))...)
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	src, err := formatNodeToBytes(fset, file)
+	if err != nil {
+		return err
+	}
+	return editFile(fset, file, src, edits)
+}
+
+// resultNameEdits insert names before types of results, with parentheses for single result.
+func (p *TraceProcessor) resultNameEdits(fn function, info *types.Info, offset int) []edit {
+	results := fn.fnType.Results
+	if results == nil || len(results.List) == 0 || len(results.List[0].Names) > 0 {
+		return nil
+	}
+
+	errorType := p.errorType()
+	hasError := false
+	for _, q := range results.List {
+		hasError = hasError || isError(q.Type, errorType, info)
+	}
+	if !hasError {
+		return nil
+	}
+
+	var edits []edit
+	errorNamed := false
+	for i, q := range results.List {
+		name := freeName(fn, "_r"+strconv.Itoa(i))
+		if !errorNamed && isError(q.Type, errorType, info) {
+			errorNamed = true
+			if isFreeName(fn, "err") {
+				name = "err"
+			}
+		}
+
+		start := int(q.Type.Pos()) - offset
+		if !results.Opening.IsValid() {
+			end := int(q.Type.End()) - offset
+			edits = append(edits, edit{start: start, end: start, text: "(" + name + " "}, edit{start: end, end: end, text: ")"})
+			continue
+		}
+		edits = append(edits, edit{start: start, end: start, text: name + " "})
+	}
+	return edits
+}
+
+// isResultName when name is of result named by nameResults, which is _r<index> with underscores appended.
+func isResultName(name string) bool {
+	index, ok := strings.CutPrefix(strings.TrimRight(name, "_"), "_r")
+	if !ok || index == "" {
+		return false
+	}
+	_, err := strconv.Atoi(index)
+	return err == nil
+}
+
+// errorType of Pattern, which is error when Pattern is not TracePattern.
+func (p *TraceProcessor) errorType() string {
+	if q, ok := p.Pattern.(*TracePattern); ok {
+		return q.ErrorType
+	}
+	return DefaultTracePattern.ErrorType
+}
+
+// freeName is name with underscores appended until it does not conflict with other names.
+func freeName(fn function, name string) string {
+	for !isFreeName(fn, name) {
+		name += "_"
+	}
+	return name
+}
+
+// isFreeName when result with name neither conflicts with names in function nor hides names declared outside of it.
+// This is so when all references to name are of declarations in nested blocks of body.
+// Names are resolved by parser, and unresolved names are references to declarations outside of function.
+func isFreeName(fn function, name string) bool {
+	if fn.body == nil {
+		return false
+	}
+
+	// declarations in top block of body, which conflict with result
+	topLevel := map[any]bool{}
+	for _, q := range fn.body.List {
+		switch s := q.(type) {
+		case *ast.AssignStmt:
+			topLevel[s] = true
+		case *ast.DeclStmt:
+			if d, ok := s.Decl.(*ast.GenDecl); ok {
+				for _, spec := range d.Specs {
+					topLevel[spec] = true
+				}
+			}
+		}
+	}
+
+	free := true
+	ast.Inspect(fn.fnType, func(n ast.Node) bool {
+		if q, ok := n.(*ast.Ident); ok && q.Name == name {
+			free = false
+		}
+		return free
+	})
+
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch q := n.(type) {
+		case *ast.SelectorExpr:
+			// selected names are fields and methods
+			ast.Inspect(q.X, visit)
+			return false
+		case *ast.BranchStmt:
+			// labels are in separate namespace
+			return false
+		}
+		free = free && isNestedName(n, name, fn.body, topLevel)
+		return free
+	}
+	ast.Inspect(fn.body, visit)
+	return free
+}
+
+// isNestedName when node is not reference to name or is reference to declaration in nested block of body.
+func isNestedName(n ast.Node, name string, body *ast.BlockStmt, topLevel map[any]bool) bool {
+	q, ok := n.(*ast.Ident)
+	if !ok || q.Name != name {
+		return true
+	}
+	if q.Obj == nil {
+		return false
+	}
+	if q.Obj.Kind == ast.Lbl {
+		return true
+	}
+
+	decl, ok := q.Obj.Decl.(ast.Node)
+	return ok && decl.Pos() > body.Lbrace && decl.End() < body.Rbrace && !topLevel[q.Obj.Decl]
+}
@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIsFreeName(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		free bool
+	}{
+		{name: "not used", src: `func f() error { return nil }`, free: true},
+		{name: "nested", src: `func f() error { if err := g(); err != nil { return err }; return nil }`, free: true},
+		{name: "function literal", src: `func f() error { return h(func(err error) error { return err }) }`, free: true},
+		{name: "field", src: `func f() error { return x.err }`, free: true},
+		{name: "top level", src: `func f() error { err := g(); return err }`, free: false},
+		{name: "top level var", src: `func f() error { var err error; return err }`, free: false},
+		{name: "parameter", src: `func f(err error) error { return err }`, free: false},
+		{name: "package level", src: `func f() error { return err }`, free: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "", "package p\n"+tc.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fns := functionsFromFile(fset, file)
+			if free := isFreeName(fns[0], "err"); free != tc.free {
+				t.Errorf("expected %v, got %v", tc.free, free)
+			}
+		})
+	}
+}
+
+func TestIsResultName(t *testing.T) {
+	for name, exp := range map[string]bool{"_r0": true, "_r12": true, "_r1__": true, "_r": false, "_rx": false, "r0": false, "err": false, "_": false} {
+		if got := isResultName(name); got != exp {
+			t.Errorf("%s: expected %v, got %v", name, exp, got)
+		}
+	}
+}
+
+func TestTraceProcessor_NameResults_ReturnAttributes(t *testing.T) {
+	var out bytes.Buffer
+	defaultOut = &out
+	defer func() {
+		defaultOut = os.Stdout
+	}()
+
+	conf := DefaultTraceConfig
+	conf.NameResults = true
+	conf.ReturnAttributes = true
+
+	p := NewTraceProcessor(DefaultTracePattern)
+	if err := p.Process("../internal/testdata/basic.go", conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "(_r0 int, err error)") {
+		t.Error("expected named results in output")
+	}
+	if !strings.Contains(out.String(), `"return.name"`) {
+		t.Error("expected named results in span attributes")
+	}
+	if strings.Contains(out.String(), `"return._r`) {
+		t.Error("expected results named by processor not in span attributes")
+	}
+}
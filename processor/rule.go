@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Visibility of function, see FunctionInfo.IsExported.
+type Visibility string
+
+const (
+	VisibilityAll        Visibility = "all"
+	VisibilityExported   Visibility = "exported"
+	VisibilityUnexported Visibility = "unexported"
+)
+
+// Rule includes or excludes functions of project by where and how they are declared.
+// Empty fields match all functions.
+type Rule struct {
+	Include bool
+
+	// Package is glob of import path, where suffix /... matches subpackages too.
+	Package string
+
+	// File is glob of file path relative to directory of rules, or of base name when it has no slash.
+	File string
+
+	// Receiver is type name of methods, which is *T for pointer receivers only.
+	Receiver string
+
+	// Function is matched against name of function.
+	Function *regexp.Regexp
+
+	Visibility Visibility
+}
+
+// RuleSet is rules of project, which file globs are relative to Dir.
+// Rules of each file are from nearest config file of its project instead, when RuleSet is made by NewProjectRuleSet.
+type RuleSet struct {
+	Dir   string
+	Rules []Rule
+
+	project *projectRules
+}
+
+// NewProjectRuleSet finds config file of each file in its directory or in its parents, and reads rules of it by load.
+// Config files are looked up once for each directory and read once.
+func NewProjectRuleSet(load func(configFile string) (RuleSet, error)) RuleSet {
+	return RuleSet{project: &projectRules{load: load, dirs: map[string]RuleSet{}, files: map[string]RuleSet{}}}
+}
+
+// projectRules are rules of config files by directories of files that they are found for.
+type projectRules struct {
+	load func(configFile string) (RuleSet, error)
+
+	mu    sync.Mutex
+	dirs  map[string]RuleSet
+	files map[string]RuleSet
+}
+
+func (s *projectRules) forDir(dir string) (RuleSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rules, ok := s.dirs[dir]; ok {
+		return rules, nil
+	}
+
+	configFile, err := findConfigFile(dir)
+	if err != nil || configFile == "" {
+		return RuleSet{}, err
+	}
+	rules, ok := s.files[configFile]
+	if !ok {
+		if rules, err = s.load(configFile); err != nil {
+			return RuleSet{}, err
+		}
+		s.files[configFile] = rules
+	}
+	s.dirs[dir] = rules
+	return rules, nil
+}
+
+// findConfigFile of project in directory or in its parents, which is empty when there is none.
+func findConfigFile(dir string) (string, error) {
+	for {
+		for _, base := range []string{".go-instrument.yaml", ".go-instrument.yml"} {
+			fileName := filepath.Join(dir, base)
+			if _, err := os.Stat(fileName); err == nil {
+				return fileName, nil
+			} else if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// forFile are rules that match package and file, which are left to be matched against functions in file.
+func (s RuleSet) forFile(fileName string) ([]Rule, error) {
+	absName, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.project != nil {
+		if s, err = s.project.forDir(filepath.Dir(absName)); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Rules) == 0 {
+		return nil, nil
+	}
+
+	var pkgPath string
+	var rules []Rule
+	for _, q := range s.Rules {
+		if q.Package != "" && pkgPath == "" {
+			if pkgPath, err = packagePath(filepath.Dir(absName)); err != nil {
+				return nil, err
+			}
+		}
+		if q.matchPackage(pkgPath) && q.matchFile(s.Dir, absName) {
+			rules = append(rules, q)
+		}
+	}
+	return rules, nil
+}
+
+func (r Rule) matchPackage(pkgPath string) bool {
+	if r.Package == "" {
+		return true
+	}
+	if pkgPath == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(r.Package, "/..."); ok {
+		if ok, _ := path.Match(prefix, pkgPath); ok {
+			return true
+		}
+		for dir := path.Dir(pkgPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if ok, _ := path.Match(prefix, dir); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(r.Package, pkgPath)
+	return ok
+}
+
+func (r Rule) matchFile(dir, absName string) bool {
+	if r.File == "" {
+		return true
+	}
+	if !strings.Contains(r.File, "/") {
+		ok, _ := path.Match(r.File, filepath.Base(absName))
+		return ok
+	}
+	rel, err := filepath.Rel(dir, absName)
+	if err != nil {
+		return false
+	}
+	ok, _ := path.Match(r.File, filepath.ToSlash(rel))
+	return ok
+}
+
+// matchFunction by receiver, name and visibility.
+func (r Rule) matchFunction(fn FunctionInfo) bool {
+	if r.Receiver != "" {
+		receiver, pointer := strings.CutPrefix(r.Receiver, "*")
+		if receiver != fn.Receiver || (pointer && !fn.Pointer) {
+			return false
+		}
+	}
+	if r.Function != nil && !r.Function.MatchString(fn.Name) {
+		return false
+	}
+	switch r.Visibility {
+	case VisibilityExported:
+		return fn.IsExported()
+	case VisibilityUnexported:
+		return !fn.IsExported()
+	}
+	return true
+}
+
+// packagePaths are import paths by directories, which are looked up once.
+var packagePaths sync.Map
+
+// packagePath is import path of directory in module of nearest go.mod, which is empty when there is no module.
+func packagePath(dir string) (string, error) {
+	if pkgPath, ok := packagePaths.Load(dir); ok {
+		return pkgPath.(string), nil
+	}
+	pkgPath, err := findPackagePath(dir)
+	if err != nil {
+		return "", err
+	}
+	packagePaths.Store(dir, pkgPath)
+	return pkgPath, nil
+}
+
+func findPackagePath(dir string) (string, error) {
+	for modDir := dir; ; modDir = filepath.Dir(modDir) {
+		data, err := os.ReadFile(filepath.Join(modDir, "go.mod"))
+		if err == nil {
+			modulePath := modfile.ModulePath(data)
+			rel, err := filepath.Rel(modDir, dir)
+			if err != nil || modulePath == "" {
+				return "", err
+			}
+			return path.Join(modulePath, filepath.ToSlash(rel)), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if filepath.Dir(modDir) == modDir {
+			return "", nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestRule_MatchPackage(t *testing.T) {
+	tests := []struct {
+		pattern string
+		pkgPath string
+		match   bool
+	}{
+		{pattern: "example.com/svc", pkgPath: "example.com/svc", match: true},
+		{pattern: "example.com/svc", pkgPath: "example.com/svc/api", match: false},
+		{pattern: "example.com/svc/...", pkgPath: "example.com/svc", match: true},
+		{pattern: "example.com/svc/...", pkgPath: "example.com/svc/api/v1", match: true},
+		{pattern: "example.com/svc/...", pkgPath: "example.com/svcs", match: false},
+		{pattern: "example.com/*/api", pkgPath: "example.com/svc/api", match: true},
+		{pattern: "example.com/svc", pkgPath: "", match: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.pattern+" "+tc.pkgPath, func(t *testing.T) {
+			if match := (Rule{Package: tc.pattern}).matchPackage(tc.pkgPath); match != tc.match {
+				t.Errorf("expected %v, got %v", tc.match, match)
+			}
+		})
+	}
+}
+
+func TestRule_MatchFunction(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		fn    FunctionInfo
+		match bool
+	}{
+		{name: "receiver", rule: Rule{Receiver: "Repo"}, fn: FunctionInfo{Receiver: "Repo", Pointer: true, Name: "Find"}, match: true},
+		{name: "pointer receiver", rule: Rule{Receiver: "*Repo"}, fn: FunctionInfo{Receiver: "Repo", Name: "Find"}, match: false},
+		{name: "function", rule: Rule{Function: regexp.MustCompile("^Must")}, fn: FunctionInfo{Name: "MustFind"}, match: true},
+		{name: "exported", rule: Rule{Visibility: VisibilityExported}, fn: FunctionInfo{Name: "find"}, match: false},
+		{name: "unexported literal", rule: Rule{Visibility: VisibilityUnexported}, fn: FunctionInfo{Name: "anonymous", Literal: true}, match: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if match := tc.rule.matchFunction(tc.fn); match != tc.match {
+				t.Errorf("expected %v, got %v", tc.match, match)
+			}
+		})
+	}
+}
+
+func TestNewProjectRuleSet(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "a/sub", "b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(root, dir, ".go-instrument.yaml"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded := map[string]int{}
+	rules := NewProjectRuleSet(func(configFile string) (RuleSet, error) {
+		loaded[configFile]++
+		return RuleSet{Dir: filepath.Dir(configFile), Rules: []Rule{{File: filepath.Base(filepath.Dir(configFile)) + ".go"}}}, nil
+	})
+
+	tests := []struct {
+		file string
+		exp  int
+	}{
+		{file: "a/a.go", exp: 1},
+		{file: "a/b.go", exp: 0},
+		{file: "a/sub/a.go", exp: 1},
+		{file: "b/b.go", exp: 1},
+		{file: "b/a.go", exp: 0},
+		{file: "c/c.go", exp: 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			q, err := rules.forFile(filepath.Join(root, tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(q) != tc.exp {
+				t.Errorf("expected %d rules, got %v", tc.exp, q)
+			}
+		})
+	}
+
+	for _, dir := range []string{"a", "b"} {
+		if n := loaded[filepath.Join(root, dir, ".go-instrument.yaml")]; n != 1 {
+			t.Errorf("expected config file of %s loaded once, got %d", dir, n)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Strip removes statements that Instrumenter would insert at the top of function bodies and imports that are not used anymore.
+// Functions are stripped regardless of selection, but only of statements that match exactly.
+// Statements are kept when rest of body uses variables they define, eg span with attributes set by hand.
+func (p *TraceProcessor) Strip(fileName string, config ...any) error {
+	var (
+		conf TraceConfig = DefaultTraceConfig
+		ok   bool
+	)
+
+	if len(config) != 0 {
+		conf, ok = config[0].(TraceConfig)
+		if !ok {
+			return ErrInvalidConfigType
+		}
+	}
+
+	writeOverlay := collectOverlay(&conf)
+	collectPackages(&conf)
+
+	fset, file, err := parseFile(fileName, conf)
+	if err != nil || file == nil {
+		return err
+	}
+
+	info, err := typesInfo(fileName, file, conf)
+	if err != nil {
+		return err
+	}
+
+	if err := p.selectFunctions(fileName, file, conf); err != nil {
+		return err
+	}
+
+	newInstrumenter, err := p.instrumenter(conf)
+	if err != nil {
+		return err
+	}
+
+	if err := p.strip(fset, file, info, newInstrumenter, conf); err != nil {
+		return err
+	}
+
+	if err := writeFile(fileName, conf, fset, file); err != nil {
+		return err
+	}
+
+	return writeOverlay()
+}
+
+func (p *TraceProcessor) strip(fset *token.FileSet, file *ast.File, info *types.Info, newInstrumenter func() Instrumenter, conf TraceConfig) error {
+	var cuts []cut
+	var imports []*types.Package
+
+	for _, fn := range functionsFromFile(fset, file) {
+		if !p.Pattern.Match(fn.fnType, TracePatternContext, info) {
+			continue
+		}
+
+		prev, err := matchInserted(fset, fn.body, p.instrumentFunction(fn, info, conf), newInstrumenter)
+		if err != nil {
+			return err
+		}
+		if prev.n == 0 || prev.stale || usesDefined(fn.body.List[:prev.n], fn.body.List[prev.n:]) {
+			continue
+		}
+		cuts = append(cuts, cut{body: fn.body, end: fn.body.List[prev.n-1].End()})
+		imports = append(imports, prev.imports...)
+	}
+
+	if len(cuts) == 0 {
+		return nil
+	}
+
+	if err := cutFile(fset, file, cuts...); err != nil {
+		return err
+	}
+
+	for _, pkg := range imports {
+		if !usesPackageName(file, packageName(pkg)) {
+			astutil.DeleteNamedImport(fset, file, importName(pkg), pkg.Path())
+		}
+	}
+
+	return nil
+}
+
+// usesPackageName when file references package by name, which is not resolved by parser to other declaration.
+// Same package can be imported by many names, thus names are checked rather than paths.
+func usesPackageName(file *ast.File, name string) bool {
+	used := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if q, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := q.X.(*ast.Ident); ok && x.Name == name && x.Obj == nil {
+				used = true
+			}
+		}
+		return !used
+	})
+	return used
+}
+
+// usesDefined when rest uses variables that are defined by stmts, eg span.
+// Variables that are assigned again, eg context parameter, are not defined by stmts.
+func usesDefined(stmts, rest []ast.Stmt) bool {
+	defs := map[*ast.Object]bool{}
+	for _, stmt := range stmts {
+		if q, ok := stmt.(*ast.AssignStmt); ok && q.Tok == token.DEFINE {
+			for _, v := range q.Lhs {
+				if id, ok := v.(*ast.Ident); ok && id.Obj != nil && id.Obj.Decl == q {
+					defs[id.Obj] = true
+				}
+			}
+		}
+	}
+
+	used := false
+	for _, stmt := range rest {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Obj != nil && defs[id.Obj] {
+				used = true
+			}
+			return !used
+		})
+	}
+	return used
+}
+
+// cut is removal of statements from opening brace of body up to end.
+type cut struct {
+	body *ast.BlockStmt
+	end  token.Pos
+}
+
+// edit replaces bytes from start to end with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// cutFile removes statements such that patched file is restored as it was before patchFile.
+// Inserted statements are followed by empty line, unless body was on same line as opening brace.
+// In that case, body is joined back into single line.
+func cutFile(fset *token.FileSet, file *ast.File, cuts ...cut) error {
+	src, err := formatNodeToBytes(fset, file)
+	if err != nil {
+		return err
+	}
+
+	var edits []edit
+
+	offset := int(file.FileStart)
+	for _, q := range cuts {
+		lbrace := int(q.body.Lbrace) - offset + 1
+		rbrace := int(q.body.Rbrace) - offset
+		end := int(q.end) - offset
+
+		if bytes.HasPrefix(src[end:], []byte("\n\n")) {
+			edits = append(edits, edit{start: lbrace, end: end + 1})
+			continue
+		}
+
+		rest := end
+		for rest < rbrace && isSpace(src[rest]) {
+			rest++
+		}
+		if rest == rbrace {
+			edits = append(edits, edit{start: lbrace, end: rbrace})
+			continue
+		}
+
+		last := rbrace
+		for last > rest && isSpace(src[last-1]) {
+			last--
+		}
+		edits = append(edits, edit{start: lbrace, end: rest, text: " "}, edit{start: last, end: rbrace, text: " "})
+	}
+
+	return editFile(fset, file, src, edits)
+}
+
+// editFile applies edits to formatted source of file and parses it again.
+func editFile(fset *token.FileSet, file *ast.File, src []byte, edits []edit) error {
+	// edits are applied from the end, so that offsets of preceding edits stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		src = append(src[:e.start], append([]byte(e.text), src[e.end:]...)...)
+	}
+
+	src, err := format.Source(src)
+	if err != nil {
+		return err
+	}
+
+	nfile, err := parser.ParseFile(fset, fset.Position(file.Pos()).Filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	*file = *nfile
+	return nil
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
@@ -0,0 +1,9 @@
+package example
+
+import (
+	"context"
+)
+
+//instrument:skip
+
+func Skip(ctx context.Context) {}
@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// packageIndex loads packages of directories once, for type-checked mode.
+type packageIndex struct {
+	mu   sync.Mutex
+	dirs map[string]*packageDir
+}
+
+type packageDir struct {
+	once sync.Once
+	pkgs []*packages.Package
+	err  error
+}
+
+// collectPackages when type-checked mode is requested and packages are not loaded by caller yet.
+func collectPackages(conf *TraceConfig) {
+	if conf.Types && conf.packages == nil {
+		conf.packages = &packageIndex{dirs: map[string]*packageDir{}}
+	}
+}
+
+func (s *packageIndex) load(dir string) ([]*packages.Package, error) {
+	s.mu.Lock()
+	d, ok := s.dirs[dir]
+	if !ok {
+		d = &packageDir{}
+		s.dirs[dir] = d
+	}
+	s.mu.Unlock()
+
+	d.once.Do(func() {
+		// dependencies are type-checked from source, as export data of newer toolchains can be unreadable by go/packages
+		d.pkgs, d.err = packages.Load(&packages.Config{
+			Mode:  packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+			Dir:   dir,
+			Tests: true,
+		}, ".")
+	})
+	return d.pkgs, d.err
+}
+
+// typesInfo has types of parameters and results of functions in file, that are evaluated in scope of file in its loaded package.
+// Types are nil when type-checked mode is not set, and empty when file is not in package.
+func typesInfo(fileName string, file *ast.File, conf TraceConfig) (*types.Info, error) {
+	if !conf.Types {
+		return nil, nil
+	}
+	if conf.packages == nil {
+		return nil, errors.New("packages are not collected")
+	}
+
+	absName, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs, err := conf.packages.load(filepath.Dir(absName))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+
+	for _, pkg := range pkgs {
+		if pkg.Types == nil {
+			continue
+		}
+		for _, pkgFile := range pkg.Syntax {
+			if pkg.Fset.Position(pkgFile.Pos()).Filename != absName {
+				continue
+			}
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				fnType, ok := n.(*ast.FuncType)
+				if !ok {
+					return true
+				}
+				for _, fields := range []*ast.FieldList{fnType.Params, fnType.Results} {
+					if fields == nil {
+						continue
+					}
+					for _, q := range fields.List {
+						// types that are declared within functions are not in scope of file, and these are left out
+						types.CheckExpr(pkg.Fset, pkg.Types, pkgFile.Name.End(), q.Type, info)
+					}
+				}
+				return true
+			})
+			return info, nil
+		}
+	}
+
+	return info, nil
+}
+
+// isContextType when t implements context.Context, eg context.Context regardless of import name and type aliases,
+// interfaces that embed it, and types that implement it.
+func isContextType(t types.Type) bool {
+	if _, ok := types.Unalias(t).(*types.TypeParam); ok {
+		return false
+	}
+	iface := contextInterface(t)
+	return iface != nil && types.Implements(t, iface)
+}
+
+// isContextAssignable when context.Context can be assigned to t, so that inserted statements can assign context with span to parameter.
+func isContextAssignable(t types.Type) bool {
+	iface := contextInterface(t)
+	return iface != nil && types.AssignableTo(iface, t)
+}
+
+// contextInterface is context.Context with time.Time of Deadline method of t, or nil when t has no such method.
+// Types of packages are identical only when they are loaded together, thus time.Time is taken from t.
+func contextInterface(t types.Type) *types.Interface {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "Deadline")
+	deadline, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	results := deadline.Type().(*types.Signature).Results()
+	if results.Len() != 2 || !isNamed(results.At(0).Type(), "time", "Time") {
+		return nil
+	}
+
+	errorType := types.Universe.Lookup("error").Type()
+	emptyInterface := types.NewInterfaceType(nil, nil)
+	done := types.NewChan(types.RecvOnly, types.NewStruct(nil, nil))
+
+	method := func(name string, params, results []types.Type) *types.Func {
+		vars := func(q []types.Type) *types.Tuple {
+			var vs []*types.Var
+			for _, t := range q {
+				vs = append(vs, types.NewParam(token.NoPos, nil, "", t))
+			}
+			return types.NewTuple(vs...)
+		}
+		return types.NewFunc(token.NoPos, nil, name, types.NewSignatureType(nil, nil, nil, vars(params), vars(results), false))
+	}
+
+	return types.NewInterfaceType([]*types.Func{
+		method("Deadline", nil, []types.Type{results.At(0).Type(), types.Typ[types.Bool]}),
+		method("Done", nil, []types.Type{done}),
+		method("Err", nil, []types.Type{errorType}),
+		method("Value", []types.Type{emptyInterface}, []types.Type{emptyInterface}),
+	}, nil).Complete()
+}
+
+func isNamed(t types.Type, pkg, name string) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == pkg && named.Obj().Name() == name
+}